@@ -1,11 +1,14 @@
 package logging
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 //LogAppender is used to push log records to a destination like a file
@@ -28,11 +31,73 @@ type ClosableAppender interface {
 	io.Closer
 }
 
+//VerifiableAppender defines an optional method for appenders that can check
+//their configuration, for example by opening a file, before any records are
+//logged.
+type VerifiableAppender interface {
+	LogAppender
+	Verify() error
+}
+
+//SyncableAppender defines an optional method for appenders that can push everything they
+//have written to durable storage, like a file appender calling fsync.
+type SyncableAppender interface {
+	LogAppender
+	Sync() error
+}
+
+//BatchAppender defines an optional method for appenders that write several records more efficiently
+//than one at a time, like network appenders. When the logging go routine has several records queued it
+//passes those that passed their levels to LogBatch, instead of calling Log for each one. Other paths, like
+//FlushTagBuffer, still call Log. The appender should check the levels of the records itself, like Log does.
+//Each call gets its own slice, so the appender can keep it, for example to send it later.
+type BatchAppender interface {
+	LogAppender
+	LogBatch(records []*LogRecord) error
+}
+
+//levelChecker is implemented by appenders that can report whether they accept a level,
+//like those built on BaseLogAppender
+type levelChecker interface {
+	CheckLevel(l LogLevel) bool
+}
+
+//enabledChecker is implemented by appenders that can be turned off, like those built on BaseLogAppender
+type enabledChecker interface {
+	Enabled() bool
+}
+
+//appenderEnabled returns false for appenders that have been turned off with SetEnabled
+func appenderEnabled(appender LogAppender) bool {
+	checker, ok := appender.(enabledChecker)
+	return !ok || checker.Enabled()
+}
+
 //BaseLogAppender provides a simple struct for building log appenders.
 type BaseLogAppender struct {
 	m         sync.RWMutex
 	level     LogLevel
 	formatter LogFormatter
+	preferred LogFormatter
+	byLevel   map[LogLevel]LogFormatter
+	record    RecordFormatter
+	disabled  int32
+}
+
+//SetEnabled turns the appender off or back on without removing it. The logging go routine skips a
+//disabled appender, it keeps its settings and stays in the appender list. Calling Log directly still logs.
+func (appender *BaseLogAppender) SetEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&appender.disabled, 0)
+	} else {
+		atomic.StoreInt32(&appender.disabled, 1)
+	}
+	atomic.AddUint64(&appenderGeneration, 1)
+}
+
+//Enabled returns false while the appender is turned off with SetEnabled
+func (appender *BaseLogAppender) Enabled() bool {
+	return atomic.LoadInt32(&appender.disabled) == 0
 }
 
 //SetLevel stores the level in the BaseLogAppender struct
@@ -40,6 +105,7 @@ func (appender *BaseLogAppender) SetLevel(l LogLevel) {
 	appender.m.Lock()
 	appender.level = l
 	appender.m.Unlock()
+	atomic.AddUint64(&appenderGeneration, 1)
 }
 
 func (appender *BaseLogAppender) checkLevel(l LogLevel) bool {
@@ -62,15 +128,90 @@ func (appender *BaseLogAppender) SetFormatter(formatter LogFormatter) {
 	appender.m.Unlock()
 }
 
+//Configure sets the level and the formatter together, so a record is never formatted with the new level
+//and the old formatter, or the other way around
+func (appender *BaseLogAppender) Configure(l LogLevel, formatter LogFormatter) {
+	appender.m.Lock()
+	appender.level = l
+	appender.formatter = formatter
+	appender.m.Unlock()
+	atomic.AddUint64(&appenderGeneration, 1)
+}
+
+//SetFormatterForLevel uses the formatter for records at the level, in place of the appender's other
+//formatters, for example to add more detail to errors. A nil formatter removes the level's formatter.
+func (appender *BaseLogAppender) SetFormatterForLevel(level LogLevel, formatter LogFormatter) {
+	appender.m.Lock()
+	if formatter == nil {
+		delete(appender.byLevel, level)
+	} else {
+		if appender.byLevel == nil {
+			appender.byLevel = make(map[LogLevel]LogFormatter)
+		}
+		appender.byLevel[level] = formatter
+	}
+	appender.m.Unlock()
+}
+
+//SetRecordFormatter stores a formatter that gets the whole record, it is used in place of the formatter
+//from SetFormatter and the default formatters, but not the formatters for specific levels. A nil formatter
+//goes back to using the LogFormatters.
+func (appender *BaseLogAppender) SetRecordFormatter(formatter RecordFormatter) {
+	appender.m.Lock()
+	appender.record = formatter
+	appender.m.Unlock()
+}
+
+//SetFormatterByName looks up a named format with GetFormatter and stores the result, like SetFormatter
+func (appender *BaseLogAppender) SetFormatterByName(name LogFormat) {
+	appender.SetFormatter(GetFormatter(name))
+}
+
+//SetDefaultFormatter declares the formatter this appender uses when SetFormatter hasn't been called,
+//taking precedence over the package's default formatter. Appenders with a natural output format,
+//like JSON, can call this when they are created.
+func (appender *BaseLogAppender) SetDefaultFormatter(formatter LogFormatter) {
+	appender.m.Lock()
+	appender.preferred = formatter
+	appender.m.Unlock()
+}
+
+//DefaultFormatter returns the formatter declared with SetDefaultFormatter, or nil if the
+//package's default formatter is used
+func (appender *BaseLogAppender) DefaultFormatter() LogFormatter {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+
+	return appender.preferred
+}
+
 func (appender *BaseLogAppender) format(record *LogRecord) string {
 	// caller is responsible for obtaining lock
-	formatter := appender.formatter
+	formatter := appender.byLevel[record.Level]
+
+	if formatter == nil && appender.record != nil {
+		return appender.record(record)
+	}
+
+	if formatter == nil {
+		formatter = appender.formatter
+	}
+
+	if formatter == nil {
+		formatter = appender.preferred
+	}
 
 	if formatter == nil {
-		formatter = defaultFormatter
+		formatter = getDefaultFormatter()
 	}
 
-	return formatter(record.Level, record.Tags, record.Message, record.Time, record.Original)
+	formatted := formatter(record.Level, record.Tags, record.Message, record.Time, originalTime(record))
+
+	if record.Stack != "" {
+		formatted = formatted + "\n" + record.Stack
+	}
+
+	return formatted
 }
 
 //NullAppender is a simple log appender that just counts the number of log messages
@@ -112,10 +253,55 @@ func (appender *ErrorAppender) Log(record *LogRecord) error {
 	return fmt.Errorf("error: %s", record.Message)
 }
 
+//BlockingAppender is provided for testing and will block when asked to log
+//a message until the test releases it, it will also maintain a count.
+//Since all appenders are called from the logging go routine, a blocked
+//appender stops all processing, which allows tests to fill the logging
+//channel deterministically.
+type BlockingAppender struct {
+	NullAppender
+	waiting int64
+	release chan bool
+}
+
+//NewBlockingAppender creates a BlockingAppender
+func NewBlockingAppender() *BlockingAppender {
+	return &BlockingAppender{release: make(chan bool)}
+}
+
+//Log waits until the appender is released, then adds to the count
+func (appender *BlockingAppender) Log(record *LogRecord) error {
+	atomic.AddInt64(&(appender.waiting), 1)
+	<-appender.release
+	atomic.AddInt64(&(appender.waiting), -1)
+	atomic.AddInt64(&(appender.count), 1)
+	return nil
+}
+
+//Release allows count calls to Log to proceed, blocking until each
+//of them has been handed off to a waiting call
+func (appender *BlockingAppender) Release(count int) {
+	for i := 0; i < count; i++ {
+		appender.release <- true
+	}
+}
+
+//Unblock permanently releases the appender, current and future calls to Log
+//will not block. Release should not be called after Unblock.
+func (appender *BlockingAppender) Unblock() {
+	close(appender.release)
+}
+
+//Waiting returns the number of calls to Log that are currently blocked
+func (appender *BlockingAppender) Waiting() int64 {
+	return atomic.LoadInt64(&(appender.waiting))
+}
+
 //ConsoleAppender can be used to write log records to standard
 //err or standard out.
 type ConsoleAppender struct {
 	useStdout bool
+	split     bool
 	BaseLogAppender
 }
 
@@ -131,6 +317,20 @@ func NewStdOutAppender() *ConsoleAppender {
 	return &ConsoleAppender{useStdout: true}
 }
 
+//NewSplitConsoleAppender creates a console appender that writes WARN
+//and ERROR records to standard err and everything else to standard out.
+func NewSplitConsoleAppender() *ConsoleAppender {
+	return &ConsoleAppender{split: true}
+}
+
+//usesStdout picks the stream for a record
+func (appender *ConsoleAppender) usesStdout(level LogLevel) bool {
+	if appender.split {
+		return level < WARN
+	}
+	return appender.useStdout
+}
+
 //Log writes the record, if its level passes the appenders level
 //to stderr or stdout
 func (appender *ConsoleAppender) Log(record *LogRecord) error {
@@ -141,7 +341,7 @@ func (appender *ConsoleAppender) Log(record *LogRecord) error {
 		return nil
 	}
 
-	if appender.useStdout {
+	if appender.usesStdout(record.Level) {
 		fmt.Fprintln(os.Stdout, appender.format(record))
 	} else {
 		fmt.Fprintln(os.Stderr, appender.format(record))
@@ -149,6 +349,65 @@ func (appender *ConsoleAppender) Log(record *LogRecord) error {
 	return nil
 }
 
+//DiscardAppender wraps another appender and drops the records with levels in a range, so the configuration
+//says which levels from a noisy library go nowhere. Records outside the range, that pass the appender's own
+//level, are passed to the wrapped appender. Closing the appender closes the wrapped appender if it can be closed.
+type DiscardAppender struct {
+	BaseLogAppender
+	min       LogLevel
+	max       LogLevel
+	target    LogAppender
+	discarded int64
+}
+
+//NewDiscardAppender creates an appender that drops records from min to max, inclusive, and passes the
+//rest to the target
+func NewDiscardAppender(min LogLevel, max LogLevel, target LogAppender) *DiscardAppender {
+	return &DiscardAppender{min: min, max: max, target: target}
+}
+
+//Log drops records in the range and passes the others to the wrapped appender
+func (appender *DiscardAppender) Log(record *LogRecord) error {
+	if appender.discards(record.Level) {
+		atomic.AddInt64(&appender.discarded, 1)
+		return nil
+	}
+
+	if !appender.BaseLogAppender.CheckLevel(record.Level) {
+		return nil
+	}
+
+	return appender.target.Log(record)
+}
+
+//CheckLevel returns false for levels in the range, otherwise it checks the appender's level and the
+//wrapped appender's level
+func (appender *DiscardAppender) CheckLevel(l LogLevel) bool {
+	if appender.discards(l) || !appender.BaseLogAppender.CheckLevel(l) {
+		return false
+	}
+
+	checker, ok := appender.target.(levelChecker)
+	return !ok || checker.CheckLevel(l)
+}
+
+//Discarded returns the number of records dropped because of their level
+func (appender *DiscardAppender) Discarded() int64 {
+	return atomic.LoadInt64(&appender.discarded)
+}
+
+//Close closes the wrapped appender if it is a ClosableAppender
+func (appender *DiscardAppender) Close() error {
+	if closer, ok := appender.target.(ClosableAppender); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (appender *DiscardAppender) discards(l LogLevel) bool {
+	return l >= appender.min && l <= appender.max
+}
+
 //MemoryAppender is useful for testing and keeps a list of logged messages
 type MemoryAppender struct {
 	BaseLogAppender
@@ -184,15 +443,130 @@ func (appender *MemoryAppender) GetLoggedMessages() []string {
 	return appender.LoggedMessages
 }
 
+//RawCaptureAppender is a WriterAppender for tests that keeps a copy of every byte slice written, so
+//the exact output, including new lines, can be checked
+type RawCaptureAppender struct {
+	*WriterAppender
+	capture *captureWriter
+}
+
+type captureWriter struct {
+	m      sync.Mutex
+	writes [][]byte
+}
+
+func (writer *captureWriter) Write(p []byte) (int, error) {
+	written := make([]byte, len(p))
+	copy(written, p)
+
+	writer.m.Lock()
+	writer.writes = append(writer.writes, written)
+	writer.m.Unlock()
+
+	return len(p), nil
+}
+
+//NewRawCaptureAppender creates an appender that captures its writes in memory
+func NewRawCaptureAppender() *RawCaptureAppender {
+	capture := new(captureWriter)
+	return &RawCaptureAppender{WriterAppender: NewWriterAppender(capture), capture: capture}
+}
+
+//Writes returns the byte slices passed to the writer, one for each call to Write
+func (appender *RawCaptureAppender) Writes() [][]byte {
+	appender.capture.m.Lock()
+	defer appender.capture.m.Unlock()
+
+	writes := make([][]byte, len(appender.capture.writes))
+	copy(writes, appender.capture.writes)
+	return writes
+}
+
+//Bytes returns everything written, joined together
+func (appender *RawCaptureAppender) Bytes() []byte {
+	appender.capture.m.Lock()
+	defer appender.capture.m.Unlock()
+
+	var all []byte
+	for _, written := range appender.capture.writes {
+		all = append(all, written...)
+	}
+	return all
+}
+
+//CallbackAppender calls a function for each record that passes its level. The callback gets a copy of the
+//record, including its tags, so it can keep the record. The callback is called on the logging go routine,
+//so it must return quickly, a slow callback delays all logging. The formatter is not used.
+type CallbackAppender struct {
+	BaseLogAppender
+	callback func(record *LogRecord)
+}
+
+//NewCallbackAppender creates an appender that calls the callback for each record
+func NewCallbackAppender(callback func(record *LogRecord)) *CallbackAppender {
+	return &CallbackAppender{callback: callback}
+}
+
+//Log checks the record's level and then calls the callback with a copy of the record
+func (appender *CallbackAppender) Log(record *LogRecord) error {
+	if !appender.CheckLevel(record.Level) {
+		return nil
+	}
+
+	appender.callback(cloneRecord(record))
+	return nil
+}
+
+//cloneRecord copies a record and its tags, for appenders that keep records
+func cloneRecord(record *LogRecord) *LogRecord {
+	clone := *record
+
+	if record.Tags != nil {
+		clone.Tags = make([]string, len(record.Tags))
+		copy(clone.Tags, record.Tags)
+	}
+
+	if record.Frames != nil {
+		clone.Frames = make([]runtime.Frame, len(record.Frames))
+		copy(clone.Frames, record.Frames)
+	}
+
+	clone.confirm = nil
+	return &clone
+}
+
 //WriterAppender is a simple appender that pushes messages as bytes to a writer
 type WriterAppender struct {
 	BaseLogAppender
-	writer io.Writer
+	writer        io.Writer
+	target        io.Writer
+	closer        io.Closer
+	gz            *gzip.Writer
+	flushInterval time.Duration
+	lastFlush     time.Time
+	flushTimer    *time.Timer
+	flushPending  bool
 }
 
 //NewWriterAppender creates an appender from the specified writer.
 func NewWriterAppender(writer io.Writer) *WriterAppender {
-	return &WriterAppender{writer: writer}
+	return &WriterAppender{writer: writer, target: writer}
+}
+
+//NewWriteCloserAppender creates an appender from the specified writer that closes the writer when the
+//appender is closed, as ClearAppenders does, like a file opened for logging.
+func NewWriteCloserAppender(writer io.WriteCloser) *WriterAppender {
+	return &WriterAppender{writer: writer, target: writer, closer: writer}
+}
+
+//NewGzipWriterAppender creates an appender that compresses the log stream with gzip before
+//writing it to the specified writer. The compressed stream is flushed at most once a second while
+//logging, and a second after a record that wasn't flushed, so a reader of a partially written stream
+//sees each message within about a second even if nothing else is logged. Close
+//must be called, as ClearAppenders does, to finish the gzip stream, the writer itself is not closed.
+func NewGzipWriterAppender(writer io.Writer) *WriterAppender {
+	gz := gzip.NewWriter(writer)
+	return &WriterAppender{writer: gz, target: writer, gz: gz, flushInterval: time.Second}
 }
 
 //Log checks the log record's level and then writes the formatted record
@@ -208,8 +582,129 @@ func (appender *WriterAppender) Log(record *LogRecord) error {
 	if appender.writer != nil {
 		_, err := appender.writer.Write([]byte(appender.format(record)))
 		_, err = appender.writer.Write([]byte("\n"))
+
+		if err == nil && appender.gz != nil {
+			if time.Since(appender.lastFlush) >= appender.flushInterval {
+				err = appender.gz.Flush()
+				appender.flushed()
+			} else {
+				appender.scheduleFlush()
+			}
+		}
+
 		return err
 	}
 
 	return nil
 }
+
+//flushed should be called inside the lock after the gzip stream is flushed, there is nothing left for the timer
+func (appender *WriterAppender) flushed() {
+	appender.lastFlush = time.Now()
+
+	if appender.flushPending {
+		appender.flushTimer.Stop()
+		appender.flushPending = false
+	}
+}
+
+//scheduleFlush should be called inside the lock, it starts the timer that flushes records written
+//since the last flush, once the flush interval has passed
+func (appender *WriterAppender) scheduleFlush() {
+	if appender.flushPending {
+		return
+	}
+
+	wait := appender.flushInterval - time.Since(appender.lastFlush)
+	appender.flushPending = true
+
+	if appender.flushTimer == nil {
+		appender.flushTimer = time.AfterFunc(wait, appender.timedFlush)
+	} else {
+		appender.flushTimer.Reset(wait)
+	}
+}
+
+//timedFlush runs on the timer's go routine, errors are sent to the logging error channel
+func (appender *WriterAppender) timedFlush() {
+	appender.m.Lock()
+
+	if !appender.flushPending {
+		appender.m.Unlock()
+		return
+	}
+
+	appender.flushPending = false
+	err := appender.gz.Flush()
+	appender.lastFlush = time.Now()
+	appender.m.Unlock()
+
+	if err != nil {
+		reportAppenderError(appender, err)
+	}
+}
+
+//Flush pushes any compressed data to the underlying writer, it does nothing for an
+//uncompressed appender
+func (appender *WriterAppender) Flush() error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if appender.gz != nil && appender.writer != nil {
+		defer appender.flushed()
+		return appender.gz.Flush()
+	}
+
+	return nil
+}
+
+//Sync flushes a compressed appender, then syncs the writer if it has a Sync method, like an *os.File
+func (appender *WriterAppender) Sync() error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if appender.writer == nil {
+		return nil
+	}
+
+	if appender.gz != nil {
+		if err := appender.gz.Flush(); err != nil {
+			return err
+		}
+		appender.flushed()
+	}
+
+	if syncer, ok := appender.target.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+//Close finishes the gzip stream for a compressed appender, which will not write anything afterwards.
+//The underlying writer is only closed if the appender was created with NewWriteCloserAppender,
+//otherwise Close does nothing for an uncompressed appender.
+func (appender *WriterAppender) Close() error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	var err error
+
+	if appender.flushPending {
+		appender.flushTimer.Stop()
+		appender.flushPending = false
+	}
+
+	if appender.gz != nil && appender.writer != nil {
+		err = appender.gz.Close()
+		appender.writer = nil
+	}
+
+	if appender.closer != nil {
+		err = appender.closer.Close()
+		appender.closer = nil
+		appender.writer = nil
+	}
+
+	return err
+}
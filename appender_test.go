@@ -2,11 +2,15 @@ package logging
 
 import (
 	"bytes"
+	"compress/gzip"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestAppenderLevel(t *testing.T) {
@@ -27,6 +31,179 @@ func TestAppenderLevel(t *testing.T) {
 	assert.Equal(t, len(secondAppender.GetLoggedMessages()), 2, "Appender should work separately.")
 }
 
+func TestAppenderDefaultFormatter(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(INFO)
+	SetDefaultFormatter(GetFormatter(FULL))
+
+	app := NewMemoryAppender()
+	app.SetDefaultFormatter(GetFormatter(MINIMAL))
+	AddAppender(app)
+
+	assert.NotNil(t, app.DefaultFormatter(), "the appender's default formatter should be returned")
+
+	Info("one")
+	WaitForIncoming()
+
+	app.SetFormatter(GetFormatter(MINIMALTAGGED))
+	Info("two")
+	WaitForIncoming()
+
+	assert.Equal(t, app.GetLoggedMessages(), []string{"one", "[INFO] two"}, "the appender's default should beat the package default, but not its formatter")
+}
+
+func TestAppenderConfigure(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(DEBUG)
+
+	memory.Configure(WARN, GetFormatter(MINIMALTAGGED))
+	assert.False(t, WouldLog(INFO, nil), "the cached appender levels should be cleared")
+
+	logger.Info("info")
+	logger.Warn("warn")
+	WaitForIncoming()
+
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"[WARN] warn"}, "the level and formatter should both be set")
+}
+
+func TestAppenderSetEnabled(t *testing.T) {
+	logger, memory := setup()
+	second := NewMemoryAppender()
+	AddAppender(second)
+
+	memory.SetEnabled(false)
+	assert.False(t, memory.Enabled(), "the appender should be disabled")
+
+	logger.Info("one")
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "a disabled appender is skipped")
+	assert.Equal(t, len(second.GetLoggedMessages()), 1, "other appenders still log")
+
+	second.SetEnabled(false)
+	assert.False(t, WouldLog(INFO, nil), "disabled appenders don't accept any level")
+
+	memory.SetEnabled(true)
+	logger.Info("two")
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"two"}, "an enabled appender logs again")
+}
+
+func TestDiscardAppender(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(VERBOSE)
+	EnableVerboseLogging()
+	defer DisableVerboseLogging()
+
+	discard := NewDiscardAppender(VERBOSE, DEBUG, memory)
+	ReplaceAppenders([]LogAppender{discard})
+
+	logger.Verbosef("%s", "verbose")
+	logger.Debug("debug")
+	logger.Info("info")
+	WaitForIncoming()
+
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"info"}, "levels in the range should be dropped")
+	assert.Equal(t, discard.Discarded(), int64(2), "dropped records should be counted")
+	assert.False(t, WouldLog(DEBUG, nil), "levels in the range aren't accepted")
+	assert.True(t, WouldLog(INFO, nil), "levels outside the range are accepted")
+}
+
+func TestSetFormatterByName(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(INFO)
+
+	app := NewMemoryAppender()
+	app.SetFormatterByName(FormatFromString("MinimalTagged"))
+	AddAppender(app)
+
+	InfoWithTags([]string{"one"}, "two")
+	WaitForIncoming()
+
+	assert.Equal(t, app.GetLoggedMessages(), []string{"[INFO] [one] two"}, "the named formatter should be used")
+}
+
+func TestSetFormatterForLevel(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(INFO)
+
+	app := NewMemoryAppender()
+	app.SetFormatter(GetFormatter(MINIMAL))
+	app.SetFormatterForLevel(ERROR, GetFormatter(MINIMALTAGGED))
+	AddAppender(app)
+
+	Info("one")
+	Error("two")
+	WaitForIncoming()
+
+	app.SetFormatterForLevel(ERROR, nil)
+	Error("three")
+	WaitForIncoming()
+
+	assert.Equal(t, app.GetLoggedMessages(), []string{"one", "[ERROR] two", "three"}, "the level's formatter should be used first")
+}
+
+func TestSetRecordFormatter(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(INFO)
+
+	app := NewMemoryAppender()
+	app.SetFormatter(GetFormatter(MINIMAL))
+	app.SetRecordFormatter(func(record *LogRecord) string {
+		return record.Logger.name + ": " + record.Message
+	})
+	app.SetFormatterForLevel(ERROR, GetFormatter(MINIMALTAGGED))
+	AddAppender(app)
+
+	Info("one")
+	Error("two")
+	WaitForIncoming()
+
+	app.SetRecordFormatter(nil)
+	Info("three")
+	WaitForIncoming()
+
+	assert.Equal(t, app.GetLoggedMessages(), []string{"_default: one", "[ERROR] two", "three"}, "the record formatter should be preferred to the formatter")
+}
+
+func BenchmarkFormat(b *testing.B) {
+	app := NewNullAppender()
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	at := time.Now()
+	record := NewLogRecord(nil, INFO, nil, "benchmark", at, at)
+	record.Replayed = true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		app.format(record)
+	}
+}
+
+func TestCallbackAppender(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(INFO)
+
+	var records []*LogRecord
+	app := NewCallbackAppender(func(record *LogRecord) {
+		records = append(records, record)
+	})
+	app.SetLevel(WARN)
+	AddAppender(app)
+
+	tags := []string{"one"}
+	WarnWithTags(tags, "two")
+	Info("three")
+	WaitForIncoming()
+	ClearAppenders()
+
+	assert.Equal(t, len(records), 1, "records should be checked against the level")
+	assert.Equal(t, records[0].Message, "two", "the callback should get the record")
+
+	tags[0] = "changed"
+	assert.Equal(t, records[0].Tags, []string{"one"}, "the callback should get a copy of the tags")
+}
+
 func TestNullAppender(t *testing.T) {
 	ClearAppenders()
 
@@ -41,6 +218,39 @@ func TestNullAppender(t *testing.T) {
 	assert.Equal(t, app.Count(), 1, "Null appender should check levels appropriately")
 }
 
+func TestBlockingAppender(t *testing.T) {
+	ClearAppenders()
+
+	app := NewBlockingAppender()
+	AddAppender(app)
+
+	SetDefaultLogLevel(INFO)
+	Info("one")
+	Info("two")
+	Info("three")
+
+	for app.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(t, app.Waiting(), 1, "Blocking appender should hold the processing go routine")
+	assert.Equal(t, app.Count(), 0, "Blocking appender should not count blocked messages")
+
+	app.Release(2)
+
+	for app.Count() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(t, app.Count(), 2, "Blocking appender should count released messages")
+
+	app.Unblock()
+
+	WaitForIncoming()
+	assert.Equal(t, app.Count(), 3, "Unblocked appender should log all messages")
+	assert.Equal(t, app.Waiting(), 0, "Unblocked appender should not be waiting")
+}
+
 func TestAppenderCheckLevel(t *testing.T) { //not sure how to test std err without subproc so this is for coverage
 	ClearAppenders()
 
@@ -76,6 +286,25 @@ func TestStdOutAppender(t *testing.T) { //not sure how to test std out without s
 	Debug("two")
 }
 
+func TestSplitConsoleAppender(t *testing.T) { //not sure how to test std out without subproc so this is for coverage
+	ClearAppenders()
+
+	app := NewSplitConsoleAppender()
+	AddAppender(app)
+
+	assert.True(t, app.usesStdout(INFO), "info goes to std out")
+	assert.True(t, app.usesStdout(DEBUG), "debug goes to std out")
+	assert.False(t, app.usesStdout(WARN), "warn goes to std err")
+	assert.False(t, app.usesStdout(ERROR), "error goes to std err")
+	assert.False(t, NewStdErrAppender().usesStdout(INFO), "std err appenders don't split")
+
+	SetDefaultLogLevel(INFO)
+	Info("one")
+	Warn("two")
+
+	WaitForIncoming()
+}
+
 func TestWriterAppender(t *testing.T) {
 	ClearAppenders()
 
@@ -107,3 +336,177 @@ func TestWriterAppender(t *testing.T) {
 	RestartLogging() //don't leave logging off
 
 }
+
+type syncBuffer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (buffer *syncBuffer) Sync() error {
+	buffer.syncs++
+	return nil
+}
+
+//lockedBuffer can be read while a timer writes to it
+type lockedBuffer struct {
+	m      sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *lockedBuffer) Write(p []byte) (int, error) {
+	buffer.m.Lock()
+	defer buffer.m.Unlock()
+	return buffer.buffer.Write(p)
+}
+
+func (buffer *lockedBuffer) Bytes() []byte {
+	buffer.m.Lock()
+	defer buffer.m.Unlock()
+	return append([]byte{}, buffer.buffer.Bytes()...)
+}
+
+func TestSync(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(DEBUG)
+
+	plain := new(syncBuffer)
+	compressed := new(syncBuffer)
+	AddAppender(NewWriterAppender(plain))
+	AddAppender(NewGzipWriterAppender(compressed))
+	AddAppender(NewMemoryAppender())
+
+	Info("one")
+
+	assert.Nil(t, Sync(), "sync should succeed")
+	assert.Equal(t, plain.syncs, 1, "the writer should be synced")
+	assert.Equal(t, compressed.syncs, 1, "the writer under the gzip stream should be synced")
+	assert.True(t, compressed.Len() > 0, "the gzip stream should be flushed")
+
+	ClearAppenders()
+}
+
+func TestWriteCloserAppender(t *testing.T) {
+	ClearAppenders()
+
+	SetDefaultLogLevel(DEBUG)
+
+	filepath := path.Join(os.TempDir(), "writecloserlogtest.txt")
+	defer os.Remove(filepath)
+	f, _ := os.Create(filepath)
+	app := NewWriteCloserAppender(f)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	AddAppender(app)
+
+	Info("one")
+
+	WaitForIncoming()
+	ClearAppenders() //will close the file
+
+	_, err := f.Write([]byte("two"))
+	assert.NotNil(t, err, "the file should be closed")
+
+	contents, _ := ioutil.ReadFile(filepath)
+	assert.Equal(t, string(contents), "one\n", "File should contain the entry")
+	assert.Nil(t, app.Close(), "closing again does nothing")
+}
+
+func TestRawCaptureAppender(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(INFO)
+
+	app := NewRawCaptureAppender()
+	app.SetFormatter(GetFormatter(MINIMAL))
+	AddAppender(app)
+
+	Info("one")
+	Info("two")
+	WaitForIncoming()
+
+	assert.Equal(t, app.Writes(), [][]byte{[]byte("one"), []byte("\n"), []byte("two"), []byte("\n")}, "each write should be captured")
+	assert.Equal(t, string(app.Bytes()), "one\ntwo\n", "the writes should be joined")
+}
+
+func TestAddAppenderWhileLogging(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(INFO)
+
+	done := make(chan bool)
+
+	go func() {
+		for i := 0; i < 500; i++ {
+			Info("one")
+		}
+		done <- true
+	}()
+
+	added := make([]*NullAppender, 0, 20)
+
+	for i := 0; i < 20; i++ {
+		app := NewNullAppender()
+		added = append(added, app)
+		AddAppender(app)
+	}
+
+	<-done
+	WaitForIncoming()
+
+	assert.Equal(t, len(currentAppenders()), 20, "all appenders should be added")
+	assert.True(t, added[0].Count() >= added[19].Count(), "earlier appenders should see at least as many messages")
+
+	ClearAppenders()
+}
+
+func TestGzipWriterAppender(t *testing.T) {
+	ClearAppenders()
+
+	SetDefaultLogLevel(DEBUG)
+
+	buf := bytes.NewBuffer(nil)
+	app := NewGzipWriterAppender(buf)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	AddAppender(app)
+
+	Info("one")
+	Debug("two")
+
+	WaitForIncoming()
+	ClearAppenders() //will finish the gzip stream
+
+	reader, err := gzip.NewReader(buf)
+	assert.Nil(t, err, "output should be a gzip stream")
+
+	out := bytes.NewBuffer(nil)
+	io.Copy(out, reader)
+
+	assert.Equal(t, out.String(), "one\ntwo\n", "gzip stream should contain both entries")
+}
+
+func TestGzipWriterAppenderFlushTimer(t *testing.T) {
+	buf := new(lockedBuffer)
+	app := NewGzipWriterAppender(buf)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	app.flushInterval = 20 * time.Millisecond
+	defer app.Close()
+
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "one", time.Now(), time.Now())))
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "two", time.Now(), time.Now())))
+
+	read := func() string {
+		reader, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+
+		if err != nil {
+			return ""
+		}
+
+		out := bytes.NewBuffer(nil)
+		io.Copy(out, reader) //the stream isn't finished, so the copy ends with an unexpected EOF
+		return out.String()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for read() != "one\ntwo\n" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Equal(t, read(), "one\ntwo\n", "the timer should flush the second record without another record or Close")
+}
@@ -0,0 +1,105 @@
+package logging
+
+/*
+BoundedMemoryAppender keeps the formatted messages of the records that pass its level, in memory, like a
+MemoryAppender with a budget. When there are more than maxRecords messages, or the messages add up to more
+than maxBytes, the oldest are evicted and passed to the eviction callback, for example so a log console can
+scroll. A limit of 0 or less is not checked. The newest message is always kept, even if it is larger than
+maxBytes by itself.
+
+The callback is called after the appender's lock is released, with a copy of each evicted record, oldest
+first. It runs on the logging go routine, or on the go routine that logged the record in synchronous mode,
+so it must return quickly, a slow callback delays all logging.
+*/
+type BoundedMemoryAppender struct {
+	BaseLogAppender
+	maxRecords int
+	maxBytes   int
+	onEvict    func(*LogRecord)
+	entries    []boundedEntry
+	start      int
+	bytes      int
+}
+
+type boundedEntry struct {
+	record  *LogRecord
+	message string
+}
+
+//NewBoundedMemoryAppender creates an appender that keeps at most maxRecords messages and maxBytes of
+//messages, the callback can be nil
+func NewBoundedMemoryAppender(maxRecords int, maxBytes int, onEvict func(*LogRecord)) *BoundedMemoryAppender {
+	return &BoundedMemoryAppender{maxRecords: maxRecords, maxBytes: maxBytes, onEvict: onEvict}
+}
+
+//Log checks the record's level, keeps its formatted message and evicts the oldest messages over the budget
+func (appender *BoundedMemoryAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+
+	if !appender.checkLevel(record.Level) {
+		appender.m.Unlock()
+		return nil
+	}
+
+	message := appender.format(record)
+	appender.entries = append(appender.entries, boundedEntry{record: cloneRecord(record), message: message})
+	appender.bytes += len(message)
+
+	var evicted []*LogRecord
+
+	for appender.count() > 1 && appender.overBudget() {
+		oldest := appender.entries[appender.start]
+		appender.entries[appender.start] = boundedEntry{}
+		appender.start++
+		appender.bytes -= len(oldest.message)
+		evicted = append(evicted, oldest.record)
+	}
+
+	//drop the evicted space once it is most of the slice
+	if appender.start > len(appender.entries)/2 {
+		appender.entries = append([]boundedEntry(nil), appender.entries[appender.start:]...)
+		appender.start = 0
+	}
+
+	onEvict := appender.onEvict
+	appender.m.Unlock()
+
+	if onEvict != nil {
+		for _, record := range evicted {
+			onEvict(record)
+		}
+	}
+
+	return nil
+}
+
+//GetLoggedMessages returns a copy of the kept messages, oldest first
+func (appender *BoundedMemoryAppender) GetLoggedMessages() []string {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+
+	messages := make([]string, 0, appender.count())
+	for _, entry := range appender.entries[appender.start:] {
+		messages = append(messages, entry.message)
+	}
+	return messages
+}
+
+//Bytes returns the total length of the kept messages
+func (appender *BoundedMemoryAppender) Bytes() int {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+
+	return appender.bytes
+}
+
+//should be called inside the lock
+func (appender *BoundedMemoryAppender) count() int {
+	return len(appender.entries) - appender.start
+}
+
+//should be called inside the lock
+func (appender *BoundedMemoryAppender) overBudget() bool {
+	return (appender.maxRecords > 0 && appender.count() > appender.maxRecords) ||
+		(appender.maxBytes > 0 && appender.bytes > appender.maxBytes)
+}
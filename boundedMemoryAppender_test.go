@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBoundedMemoryAppenderCount(t *testing.T) {
+	var evicted []string
+	app := NewBoundedMemoryAppender(2, 0, func(record *LogRecord) {
+		evicted = append(evicted, record.Message)
+	})
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	for _, message := range []string{"one", "two", "three", "four"} {
+		assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, message, time.Now(), time.Now())))
+	}
+
+	assert.Equal(t, app.GetLoggedMessages(), []string{"three", "four"}, "the newest records should be kept")
+	assert.Equal(t, evicted, []string{"one", "two"}, "evicted records should be passed to the callback, oldest first")
+	assert.Equal(t, app.Bytes(), len("three")+len("four"), "the bytes should match the kept messages")
+}
+
+func TestBoundedMemoryAppenderBytes(t *testing.T) {
+	evictions := 0
+	app := NewBoundedMemoryAppender(0, 10, func(record *LogRecord) {
+		evictions++
+	})
+	app.SetFormatter(GetFormatter(MINIMAL))
+	app.SetLevel(WARN)
+
+	app.Log(NewLogRecord(nil, WARN, nil, "12345", time.Now(), time.Now()))
+	app.Log(NewLogRecord(nil, INFO, nil, "skipped", time.Now(), time.Now()))
+	app.Log(NewLogRecord(nil, WARN, nil, "6789", time.Now(), time.Now()))
+	assert.Equal(t, app.Bytes(), 9, "messages under the budget are kept")
+	assert.Equal(t, evictions, 0, "nothing is evicted under the budget")
+
+	app.Log(NewLogRecord(nil, ERROR, nil, "abc", time.Now(), time.Now()))
+	assert.Equal(t, app.GetLoggedMessages(), []string{"6789", "abc"}, "the oldest should be evicted over the budget")
+	assert.Equal(t, app.Bytes(), 7)
+
+	app.Log(NewLogRecord(nil, ERROR, nil, "a long message over the budget", time.Now(), time.Now()))
+	assert.Equal(t, app.GetLoggedMessages(), []string{"a long message over the budget"}, "the newest message is always kept")
+	assert.Equal(t, evictions, 3)
+}
@@ -64,6 +64,14 @@ Loggers have a four methods for each log level, one for formatted messages, and
 	Debugf(fmt string, args ...interface{})
 	Debug(args ...interface{})
 
+The plain methods join their arguments like fmt.Sprint, which only adds spaces between arguments that
+aren't strings. Each level also has a method that always adds spaces, like fmt.Sprintln, without the trailing new line.
+
+	Errorln(args ...interface{})
+	Warnln(args ...interface{})
+	Infoln(args ...interface{})
+	Debugln(args ...interface{})
+
 Verbose is special, since it rarely should/would be called without formatting.
 
 	VerboseWithTagsf(tags []string, fmt string, args ...interface{})
@@ -77,6 +85,8 @@ All loggers share the same appenders - but appenders can be associated with a le
 Each logger has an optional buffer, that will be flushed whenever its level/tags change.
 This buffer contains un-passed messages. So that it is possible to configure the system to capture messages and replay them latter.
 Replayed messages are tagged and have a double time stamp.
+Buffers can also be kept per tag, with SetTagBufferLength, to capture the un-passed messages with a tag from every logger
+and write them together with FlushTagBuffer. DisableBuffering removes every buffer, for plain logging without replay.
 
 To use go vet with this package you can use the form:
 
@@ -0,0 +1,327 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+//DefaultElasticBatchSize is the number of records an ElasticAppender collects before sending them
+const DefaultElasticBatchSize = 100
+
+//DefaultElasticFlushInterval is the longest an ElasticAppender holds records before sending them
+const DefaultElasticFlushInterval = 5 * time.Second
+
+//elasticMaxQueued is the most batches an ElasticAppender holds while earlier ones are being sent,
+//batches over the limit are dropped so that a slow endpoint can't use unbounded memory
+const elasticMaxQueued = 16
+
+//HTTPDoer sends an http request and returns the response, *http.Client implements it
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+/*
+ElasticAppender batches records into the Elasticsearch bulk format and posts them to an endpoint,
+like http://localhost:9200/_bulk.
+
+Each record is indexed into the index named by the prefix and the UTC date of the record's original
+time, so a prefix of "logs-" produces indexes like logs-2024.01.02. The document contains the
+timestamp, level, tags, message and logger name, the appender's formatter is not used.
+
+Records are sent when the batch is full, or when the flush interval has passed since the first record
+in the batch, even if nothing else is logged. Batches are posted in order by a go routine the appender
+starts while it has batches to send, so a slow endpoint doesn't hold up the logging go routine. If too
+many batches are waiting, new ones are dropped. Errors from sending a batch, and dropped batches, are
+sent to the error channel, and a failed batch is not retried. Flush, Sync and Close, which ClearAppenders
+calls, send any remaining records and wait for every batch to be posted, returning the error for the last one.
+*/
+type ElasticAppender struct {
+	BaseLogAppender
+	doer          HTTPDoer
+	endpoint      string
+	prefix        string
+	batchSize     int
+	flushInterval time.Duration
+	pending       bytes.Buffer
+	count         int
+	timer         *time.Timer
+	generation    uint64
+	queue         []*elasticBatch
+	sending       bool
+}
+
+//elasticBatch is a request body waiting to be posted, done is set when a caller waits for it
+type elasticBatch struct {
+	body  []byte
+	count int
+	done  chan error
+}
+
+type elasticAction struct {
+	Index elasticIndex `json:"index"`
+}
+
+type elasticIndex struct {
+	Index string `json:"_index"`
+}
+
+type elasticDocument struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Level     string    `json:"level"`
+	Tags      []string  `json:"tags,omitempty"`
+	Message   string    `json:"message"`
+	Logger    string    `json:"logger,omitempty"`
+	Replayed  bool      `json:"replayed,omitempty"`
+	Stack     string    `json:"stack,omitempty"`
+}
+
+type elasticResponse struct {
+	Errors bool `json:"errors"`
+}
+
+//NewElasticAppender creates an appender that posts records to the bulk endpoint with the doer,
+//using the default batch size and flush interval
+func NewElasticAppender(doer HTTPDoer, endpoint string, indexPrefix string) *ElasticAppender {
+	return &ElasticAppender{
+		doer:          doer,
+		endpoint:      endpoint,
+		prefix:        indexPrefix,
+		batchSize:     DefaultElasticBatchSize,
+		flushInterval: DefaultElasticFlushInterval,
+	}
+}
+
+//SetBatch changes the number of records sent together and the longest records are held,
+//a size of one or less sends every record as it is logged, the interval applies to the next batch
+func (appender *ElasticAppender) SetBatch(size int, interval time.Duration) {
+	appender.m.Lock()
+	appender.batchSize = size
+	appender.flushInterval = interval
+	appender.m.Unlock()
+}
+
+//Log checks the record's level and adds it to the batch, handing the batch off to be sent if it is full
+func (appender *ElasticAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if !appender.checkLevel(record.Level) {
+		return nil
+	}
+
+	if err := appender.add(record); err != nil {
+		return err
+	}
+
+	if appender.count >= appender.batchSize {
+		appender.handOff(nil)
+	}
+
+	return nil
+}
+
+//LogBatch adds the records that pass the appender's level to the batch with one lock, handing off
+//each batch that fills
+func (appender *ElasticAppender) LogBatch(records []*LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	var firstErr error
+
+	for _, record := range records {
+		if !appender.checkLevel(record.Level) {
+			continue
+		}
+
+		if err := appender.add(record); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if appender.count >= appender.batchSize {
+			appender.handOff(nil)
+		}
+	}
+
+	return firstErr
+}
+
+//Flush sends any records in the current batch and waits for every batch to be posted, it returns
+//the error from posting the current batch, errors from earlier batches go to the error channel
+func (appender *ElasticAppender) Flush() error {
+	done := make(chan error, 1)
+
+	appender.m.Lock()
+	appender.handOff(done)
+	appender.m.Unlock()
+
+	return <-done
+}
+
+//Sync sends any records in the current batch, like Flush
+func (appender *ElasticAppender) Sync() error {
+	return appender.Flush()
+}
+
+//Close sends any records in the current batch, like Flush, the doer is not closed
+func (appender *ElasticAppender) Close() error {
+	return appender.Flush()
+}
+
+//should be called inside the lock
+func (appender *ElasticAppender) add(record *LogRecord) error {
+	doc := elasticDocument{
+		Timestamp: record.Original,
+		Level:     record.Level.String(),
+		Tags:      record.Tags,
+		Message:   record.Message,
+		Replayed:  record.Replayed,
+		Stack:     record.Stack,
+	}
+
+	if record.Logger != nil {
+		doc.Logger = record.Logger.name
+	}
+
+	action := elasticAction{Index: elasticIndex{Index: appender.prefix + record.Original.UTC().Format("2006.01.02")}}
+
+	actionLine, err := json.Marshal(action)
+
+	if err != nil {
+		return err
+	}
+
+	sourceLine, err := json.Marshal(doc)
+
+	if err != nil {
+		return err
+	}
+
+	appender.pending.Write(actionLine)
+	appender.pending.WriteByte('\n')
+	appender.pending.Write(sourceLine)
+	appender.pending.WriteByte('\n')
+	appender.count++
+
+	if appender.count == 1 && appender.flushInterval > 0 {
+		generation := appender.generation
+		appender.timer = time.AfterFunc(appender.flushInterval, func() { appender.flushAfterInterval(generation) })
+	}
+
+	return nil
+}
+
+//flushAfterInterval hands off the batch the timer was started for, if it is still being collected
+func (appender *ElasticAppender) flushAfterInterval(generation uint64) {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if generation == appender.generation && appender.count > 0 {
+		appender.handOff(nil)
+	}
+}
+
+//should be called inside the lock, queues the current batch and starts a go routine to send it if
+//there isn't one, a batch with a done channel is always queued, even when it is empty, so that the
+//caller can wait for the batches before it
+func (appender *ElasticAppender) handOff(done chan error) {
+	appender.generation++
+
+	if appender.timer != nil {
+		appender.timer.Stop()
+		appender.timer = nil
+	}
+
+	if appender.count == 0 && done == nil {
+		return
+	}
+
+	batch := &elasticBatch{body: make([]byte, appender.pending.Len()), count: appender.count, done: done}
+	copy(batch.body, appender.pending.Bytes())
+
+	appender.pending.Reset()
+	appender.count = 0
+
+	if done == nil && len(appender.queue) >= elasticMaxQueued {
+		go reportAppenderError(appender, fmt.Errorf("elasticsearch bulk request for %d records dropped, %d requests are waiting", batch.count, len(appender.queue)))
+		return
+	}
+
+	appender.queue = append(appender.queue, batch)
+
+	if !appender.sending {
+		appender.sending = true
+		go appender.sendQueued()
+	}
+}
+
+//sendQueued posts the queued batches in order, and exits when there are none left
+func (appender *ElasticAppender) sendQueued() {
+	for {
+		appender.m.Lock()
+
+		if len(appender.queue) == 0 {
+			appender.sending = false
+			appender.m.Unlock()
+			return
+		}
+
+		batch := appender.queue[0]
+		appender.queue[0] = nil
+		appender.queue = appender.queue[1:]
+		appender.m.Unlock()
+
+		err := appender.post(batch)
+
+		if batch.done != nil {
+			batch.done <- err
+		} else if err != nil {
+			//reported from another go routine, ClearAppenders holds the logging lock while it waits in Close
+			go reportAppenderError(appender, err)
+		}
+	}
+}
+
+//post sends a batch without holding the lock
+func (appender *ElasticAppender) post(batch *elasticBatch) error {
+	if batch.count == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest("POST", appender.endpoint, bytes.NewReader(batch.body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := appender.doer.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return fmt.Errorf("elasticsearch bulk request for %d records failed with status %d", batch.count, resp.StatusCode)
+	}
+
+	var result elasticResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && err != io.EOF {
+		return err
+	}
+
+	if result.Errors {
+		return fmt.Errorf("elasticsearch bulk request for %d records reported item errors", batch.count)
+	}
+
+	return nil
+}
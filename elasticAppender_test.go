@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeDoer struct {
+	m      sync.Mutex
+	bodies []string
+	status int
+	result string
+}
+
+func (doer *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	doer.m.Lock()
+	defer doer.m.Unlock()
+
+	doer.bodies = append(doer.bodies, string(body))
+
+	return &http.Response{
+		StatusCode: doer.status,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(doer.result)),
+	}, nil
+}
+
+func (doer *fakeDoer) getBodies() []string {
+	doer.m.Lock()
+	defer doer.m.Unlock()
+
+	return doer.bodies
+}
+
+//waitForBodies waits up to a second for the appender's go routine to post count bodies
+func (doer *fakeDoer) waitForBodies(count int) []string {
+	for i := 0; i < 1000 && len(doer.getBodies()) < count; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	return doer.getBodies()
+}
+
+func (doer *fakeDoer) setResponse(status int, result string) {
+	doer.m.Lock()
+	doer.status = status
+	doer.result = result
+	doer.m.Unlock()
+}
+
+func TestElasticAppender(t *testing.T) {
+	doer := &fakeDoer{status: 200, result: `{"errors":false}`}
+	app := NewElasticAppender(doer, "http://localhost:9200/_bulk", "logs-")
+	app.SetBatch(2, time.Hour)
+
+	logger := GetLogger("elastic").(*LoggerImpl)
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	assert.Nil(t, app.Log(NewLogRecord(logger, INFO, []string{"one"}, "first", when, when)))
+	assert.Equal(t, len(doer.getBodies()), 0, "records should wait for a full batch")
+
+	assert.Nil(t, app.Log(NewLogRecord(logger, ERROR, nil, "second", when, when)))
+	assert.Equal(t, len(doer.waitForBodies(1)), 1, "a full batch should be sent")
+
+	lines := strings.Split(strings.TrimSuffix(doer.getBodies()[0], "\n"), "\n")
+	assert.Equal(t, len(lines), 4, "each record has an action line and a source line")
+	assert.Equal(t, lines[0], `{"index":{"_index":"logs-2024.01.02"}}`, "the index should include the date")
+	assert.Equal(t, lines[1], `{"@timestamp":"2024-01-02T03:04:05Z","level":"INFO","tags":["one"],"message":"first","logger":"elastic"}`)
+	assert.Equal(t, lines[3], `{"@timestamp":"2024-01-02T03:04:05Z","level":"ERROR","message":"second","logger":"elastic"}`)
+
+	assert.Nil(t, app.Log(NewLogRecord(logger, INFO, nil, "third", when, when)))
+	assert.Nil(t, app.Close())
+	assert.Equal(t, len(doer.getBodies()), 2, "close should send the remaining records")
+	assert.Nil(t, app.Close())
+	assert.Equal(t, len(doer.getBodies()), 2, "an empty batch isn't sent")
+}
+
+func TestElasticAppenderErrors(t *testing.T) {
+	errors := make(chan error, 10)
+	CaptureLoggingErrors(errors)
+	defer CaptureLoggingErrors(nil)
+
+	doer := &fakeDoer{status: 500}
+	app := NewElasticAppender(doer, "http://localhost:9200/_bulk", "logs-")
+	app.SetBatch(1, time.Hour)
+
+	record := NewLogRecord(nil, INFO, nil, "first", time.Now(), time.Now())
+
+	assert.Nil(t, app.Log(record), "sending happens after Log returns")
+	err := <-errors
+	assert.Contains(t, err.Error(), "status 500", "a failed status should be sent to the error channel")
+
+	doer.setResponse(200, `{"errors":true}`)
+	app.SetBatch(2, time.Hour)
+	assert.Nil(t, app.Log(record))
+	assert.NotNil(t, app.Flush(), "item errors should be returned from flush")
+
+	app.SetLevel(ERROR)
+	assert.Nil(t, app.Log(record), "the level should be checked")
+	assert.Nil(t, app.Flush())
+	assert.Equal(t, len(doer.getBodies()), 2, "records below the level aren't sent")
+}
+
+func TestElasticAppenderFlushInterval(t *testing.T) {
+	doer := &fakeDoer{status: 200, result: `{"errors":false}`}
+	app := NewElasticAppender(doer, "http://localhost:9200/_bulk", "logs-")
+	app.SetBatch(10, 20*time.Millisecond)
+	defer app.Close()
+
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "quiet", time.Now(), time.Now())))
+	assert.Equal(t, len(doer.getBodies()), 0, "records should wait for the interval")
+
+	bodies := doer.waitForBodies(1)
+	assert.Equal(t, len(bodies), 1, "the batch should be sent after the interval without more records")
+	assert.Contains(t, bodies[0], `"message":"quiet"`)
+}
+
+func TestElasticAppenderSendsOffTheLoggingGoRoutine(t *testing.T) {
+	doer := &slowDoer{release: make(chan bool)}
+	app := NewElasticAppender(doer, "http://localhost:9200/_bulk", "logs-")
+	app.SetBatch(1, time.Hour)
+
+	done := make(chan bool)
+	go func() {
+		app.Log(NewLogRecord(nil, INFO, nil, "one", time.Now(), time.Now()))
+		app.Log(NewLogRecord(nil, INFO, nil, "two", time.Now(), time.Now()))
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Log should not wait for the endpoint")
+	}
+
+	close(doer.release)
+	assert.Nil(t, app.Close(), "close should wait for the queued batches")
+	assert.Equal(t, atomic.LoadInt32(&doer.posts), 2, "every batch should be posted")
+}
+
+type slowDoer struct {
+	release chan bool
+	posts   int32
+}
+
+func (doer *slowDoer) Do(req *http.Request) (*http.Response, error) {
+	<-doer.release
+	atomic.AddInt32(&doer.posts, 1)
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"errors":false}`))}, nil
+}
+
+func TestElasticAppenderLogBatch(t *testing.T) {
+	doer := &fakeDoer{status: 200, result: `{"errors":false}`}
+	app := NewElasticAppender(doer, "http://localhost:9200/_bulk", "logs-")
+	app.SetBatch(2, time.Hour)
+	app.SetLevel(WARN)
+
+	records := []*LogRecord{
+		NewLogRecord(nil, WARN, nil, "one", time.Now(), time.Now()),
+		NewLogRecord(nil, INFO, nil, "skipped", time.Now(), time.Now()),
+		NewLogRecord(nil, ERROR, nil, "two", time.Now(), time.Now()),
+		NewLogRecord(nil, ERROR, nil, "three", time.Now(), time.Now()),
+	}
+
+	assert.Nil(t, app.LogBatch(records))
+	assert.Equal(t, len(doer.waitForBodies(1)), 1, "a full batch should be sent")
+	assert.Equal(t, strings.Count(doer.getBodies()[0], "\n"), 4, "the batch should have two records")
+
+	assert.Nil(t, app.Flush())
+	assert.Equal(t, len(doer.getBodies()), 2, "the rest should be sent when flushed")
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"os"
+	"strings"
+)
+
+//ConfigureFromEnv sets up the default logging configuration from environment variables.
+//
+//	LOG_LEVEL sets the default log level, using ParseLevel
+//	LOG_FORMAT sets the default formatter, using FormatFromString
+//	LOG_OUTPUT replaces the appenders with one writing to stderr, stdout or the named file
+//
+//Variables that aren't set leave the current configuration alone. Unknown levels and formats, and
+//LOG_LEVEL=default, are ignored and a warning is logged. If the output file can't be opened the error is returned and the
+//appenders are not changed. The output file is closed when the appenders are cleared.
+func ConfigureFromEnv() error {
+
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		level, err := ParseLevel(value)
+
+		if err != nil {
+			Warnf("ignoring unknown LOG_LEVEL %q", value)
+		} else if level == DEFAULT {
+			Warnf("ignoring LOG_LEVEL %q, the default logger needs a level other than DEFAULT", value)
+		} else {
+			SetDefaultLogLevel(level)
+		}
+	}
+
+	if value := os.Getenv("LOG_FORMAT"); value != "" {
+		format := FormatFromString(value)
+
+		if format == SIMPLE && strings.ToLower(value) != string(SIMPLE) {
+			Warnf("ignoring unknown LOG_FORMAT %q", value)
+		} else {
+			SetDefaultFormatter(GetFormatter(format))
+		}
+	}
+
+	if value := os.Getenv("LOG_OUTPUT"); value != "" {
+		var appender LogAppender
+
+		switch strings.ToLower(value) {
+		case "stderr":
+			appender = NewStdErrAppender()
+		case "stdout":
+			appender = NewStdOutAppender()
+		default:
+			file, err := os.OpenFile(value, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+			if err != nil {
+				return err
+			}
+
+			appender = NewWriteCloserAppender(file)
+		}
+
+		ReplaceAppenders([]LogAppender{appender})
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestConfigureFromEnv(t *testing.T) {
+
+	filepath := path.Join(os.TempDir(), "envlogtest.txt")
+	os.Remove(filepath)
+	defer os.Remove(filepath)
+
+	os.Setenv("LOG_LEVEL", "warn")
+	os.Setenv("LOG_FORMAT", "Minimal")
+	os.Setenv("LOG_OUTPUT", filepath)
+
+	err := ConfigureFromEnv()
+
+	os.Unsetenv("LOG_LEVEL")
+	os.Unsetenv("LOG_FORMAT")
+	os.Unsetenv("LOG_OUTPUT")
+
+	assert.Nil(t, err, "configuration should succeed")
+	assert.Equal(t, DefaultLevel(), WARN, "LOG_LEVEL should set the default level")
+
+	Warn("one")
+	Info("two")
+
+	WaitForIncoming()
+	PauseLogging() // data race if we don't pause
+
+	buf := bytes.NewBuffer(nil)
+	f, _ := os.Open(filepath)
+	io.Copy(buf, f)
+	f.Close()
+
+	RestartLogging() //don't leave logging off
+	SetDefaultFormatter(GetFormatter(FULL))
+
+	assert.Equal(t, buf.String(), "one\n", "LOG_OUTPUT and LOG_FORMAT should configure the appender")
+
+	file := currentAppenders()[0].(*WriterAppender).closer.(*os.File)
+	ClearAppenders()
+
+	_, err = file.Write([]byte("closed"))
+	assert.True(t, errors.Is(err, os.ErrClosed), "ClearAppenders should close the LOG_OUTPUT file")
+}
+
+func TestConfigureFromEnvUnknownValues(t *testing.T) {
+
+	memory := NewMemoryAppender()
+	memory.SetFormatter(GetFormatter(MINIMAL))
+	ClearAppenders()
+	AddAppender(memory)
+	SetDefaultLogLevel(INFO)
+
+	os.Setenv("LOG_LEVEL", "loud")
+	os.Setenv("LOG_FORMAT", "fancy")
+
+	err := ConfigureFromEnv()
+
+	os.Unsetenv("LOG_LEVEL")
+	os.Unsetenv("LOG_FORMAT")
+
+	WaitForIncoming()
+	assert.Nil(t, err, "unknown values should not be errors")
+	assert.Equal(t, DefaultLevel(), INFO, "unknown levels should be ignored")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 2, "unknown values should generate warnings")
+	assert.True(t, currentAppenders()[0] == memory, "appenders should be unchanged")
+}
+
+func TestConfigureFromEnvDefaultLevel(t *testing.T) {
+
+	memory := NewMemoryAppender()
+	memory.SetFormatter(GetFormatter(MINIMAL))
+	ClearAppenders()
+	AddAppender(memory)
+	SetDefaultLogLevel(INFO)
+
+	os.Setenv("LOG_LEVEL", "default")
+	err := ConfigureFromEnv()
+	os.Unsetenv("LOG_LEVEL")
+
+	WaitForIncoming()
+	assert.Nil(t, err, "the default level should not be an error")
+	assert.Equal(t, DefaultLevel(), INFO, "the default level should be ignored")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 1, "the default level should generate a warning")
+	assert.NotContains(t, memory.GetLoggedMessages()[0], "unknown", "the default level is known, the warning should say why it was ignored")
+}
@@ -3,9 +3,79 @@ package logging
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+//tagStyle controls how the built-in formatters render tags, formatters run without the
+//logging lock so it is stored as an atomic value
+var tagStyle atomic.Value
+
+type tagRendering struct {
+	separator string
+	open      string
+	close     string
+}
+
+//minimalTimeLayout is the time layout used by MINIMALTIMED, stored as a string
+var minimalTimeLayout atomic.Value
+
+//replayMarker holds the function FULL uses to mark replayed messages, stored as a replayMarking
+var replayMarker atomic.Value
+
+type replayMarking struct {
+	marker func(original time.Time) string
+}
+
+func init() {
+	tagStyle.Store(tagRendering{separator: " ", open: "[", close: "]"})
+	replayMarker.Store(replayMarking{marker: defaultReplayMarker})
+	minimalTimeLayout.Store(time.StampMilli)
+}
+
+//SetMinimalTimeLayout changes the time layout MINIMALTIMED puts before the message, the default
+//is time.StampMilli
+func SetMinimalTimeLayout(layout string) {
+	minimalTimeLayout.Store(layout)
+}
+
+func defaultReplayMarker(original time.Time) string {
+	return fmt.Sprintf("[replayed from %v]", original.Format(time.StampMilli))
+}
+
+//SetReplayMarker changes the text the FULL formatter puts before the message of a replayed record, the
+//default is like "[replayed from Jan  2 15:04:05.000]" with the original time. A marker that returns an
+//empty string leaves replays unmarked. Pass nil to go back to the default.
+func SetReplayMarker(marker func(original time.Time) string) {
+	if marker == nil {
+		marker = defaultReplayMarker
+	}
+	replayMarker.Store(replayMarking{marker: marker})
+}
+
+//SetTagSeparator changes the string the built-in formatters put between tags, the default
+//is a space. Tags that contain the separator can't be told apart in the output.
+func SetTagSeparator(separator string) {
+	style := tagStyle.Load().(tagRendering)
+	style.separator = separator
+	tagStyle.Store(style)
+}
+
+//SetTagBrackets changes the strings the built-in formatters put around the tags, the default
+//is "[" and "]"
+func SetTagBrackets(open string, close string) {
+	style := tagStyle.Load().(tagRendering)
+	style.open = open
+	style.close = close
+	tagStyle.Store(style)
+}
+
+//formatTags renders tags with the current separator and brackets
+func formatTags(tags []string) string {
+	style := tagStyle.Load().(tagRendering)
+	return style.open + strings.Join(tags, style.separator) + style.close
+}
+
 //LogFormat is the name of a known formatting function.
 type LogFormat string
 
@@ -15,14 +85,19 @@ const MINIMAL LogFormat = "minimal"
 //MINIMALTAGGED describes a formatter that just prints the level, tags and message, replays are not indicated
 const MINIMALTAGGED LogFormat = "minimaltagged"
 
-//SIMPLE describes a formatter that just prints the date, level and message, replays are not indicated
+//MINIMALTIMED describes a formatter that prints the time and message, the time layout can be changed with
+//SetMinimalTimeLayout, replays are not indicated
+const MINIMALTIMED LogFormat = "minimaltimed"
+
+//SIMPLE describes a formatter that just prints the date to ms accuracy, level and message, replays are not indicated
 const SIMPLE LogFormat = "simple"
 
-//FULL formats messages with the date to ms accuracy, the level, tags and message. Replayed messages have a special field added.
+//FULL formats messages with the date to ms accuracy, the level, tags and message. Replayed messages have a special field added,
+//appenders mark the records that are flagged as Replayed, even when their original time is the same as their time.
 const FULL LogFormat = "full"
 
 //FormatFromString converts a string name to a LogFormat. Valid
-//arguemnts include full, simple, minimaltagged and minimal. An
+//arguemnts include full, simple, minimaltagged, minimaltimed and minimal. An
 //unknown string will be treated like simple.
 func FormatFromString(formatName string) LogFormat {
 	formatName = strings.ToLower(formatName)
@@ -33,6 +108,8 @@ func FormatFromString(formatName string) LogFormat {
 		return SIMPLE
 	case "minimaltagged":
 		return MINIMALTAGGED
+	case "minimaltimed":
+		return MINIMALTIMED
 	case "minimal":
 		return MINIMAL
 	default:
@@ -49,6 +126,8 @@ func GetFormatter(formatName LogFormat) LogFormatter {
 		return simpleFormat
 	case MINIMALTAGGED:
 		return minimalWithTagsFormat
+	case MINIMALTIMED:
+		return minimalTimedFormat
 	case MINIMAL:
 		return minimalFormat
 	default:
@@ -60,29 +139,95 @@ func GetFormatter(formatName LogFormat) LogFormatter {
 //Original time is provided times when the formatter has to construct a replayed message from the buffer
 type LogFormatter func(level LogLevel, tags []string, message string, t time.Time, original time.Time) string
 
+//RecordFormatter is a function type used to convert a log record into a string, with access to the whole
+//record, like the logger and sequence number, instead of the positional arguments of a LogFormatter.
+type RecordFormatter func(record *LogRecord) string
+
+//AdaptFormatter wraps a LogFormatter as a RecordFormatter, so existing formatters can be used where a
+//RecordFormatter is expected. The original time is passed as described by originalTime.
+func AdaptFormatter(formatter LogFormatter) RecordFormatter {
+	return func(record *LogRecord) string {
+		return formatter(record.Level, record.Tags, record.Message, record.Time, originalTime(record))
+	}
+}
+
+//originalTime is the original time a LogFormatter gets for the record. It is only different from the record's
+//time for replayed records, which is how LogFormatters detect a replay, so a replayed record whose original
+//time is the same as its time passes an original one nanosecond later.
+func originalTime(record *LogRecord) time.Time {
+	if !record.Replayed {
+		return record.Time
+	}
+
+	if record.Original == record.Time {
+		return record.Original.Add(time.Nanosecond)
+	}
+
+	return record.Original
+}
+
+//fullFormat is FULL for callers that only have the positional arguments, so replays are detected
+//by comparing the times
 func fullFormat(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
+	return fullRecordFormat(&LogRecord{Level: level, Tags: tags, Message: message, Time: t, Original: original, Replayed: original != t})
+}
+
+func fullRecordFormat(record *LogRecord) string {
+	message := record.Message
 
-	if original != t {
-		message = fmt.Sprintf("[replayed from %v] %v", original.Format(time.StampMilli), message)
+	if record.Replayed {
+		if marker := replayMarker.Load().(replayMarking).marker(record.Original); marker != "" {
+			message = marker + " " + message
+		}
 	}
 
-	if tags != nil && len(tags) > 0 {
-		return fmt.Sprintf("[%v] [%v] %v %v", t.Format(time.StampMilli), level, tags, message)
+	if len(record.Tags) > 0 {
+		return fmt.Sprintf("[%v] [%v] %v %v", record.Time.Format(time.StampMilli), record.Level, formatTags(record.Tags), message)
 	}
-	return fmt.Sprintf("[%v] [%v] %v", t.Format(time.StampMilli), level, message)
+	return fmt.Sprintf("[%v] [%v] %v", record.Time.Format(time.StampMilli), record.Level, message)
 }
 
 func simpleFormat(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
-	return fmt.Sprintf("[%v] [%v] %v", t.Format(time.Stamp), level, message)
+	return fmt.Sprintf("[%v] [%v] %v", t.Format(time.StampMilli), level, message)
 }
 
 func minimalFormat(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
 	return message
 }
 
+func minimalTimedFormat(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
+	return t.Format(minimalTimeLayout.Load().(string)) + " " + message
+}
+
 func minimalWithTagsFormat(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
 	if tags != nil && len(tags) > 0 {
-		return fmt.Sprintf("[%v] %v %v", level, tags, message)
+		return fmt.Sprintf("[%v] %v %v", level, formatTags(tags), message)
 	}
 	return fmt.Sprintf("[%v] %v", level, message)
 }
+
+//CompositeFormatter creates a formatter that runs each of the formatters on a record and joins
+//their output with the separator, formatters that return an empty string are skipped. This
+//can be used to add a structured sidecar to a human readable line.
+func CompositeFormatter(separator string, formatters ...LogFormatter) LogFormatter {
+	return func(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
+		parts := make([]string, 0, len(formatters))
+
+		for _, formatter := range formatters {
+			part := formatter(level, tags, message, t, original)
+
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		return strings.Join(parts, separator)
+	}
+}
+
+//DiscardFormatter returns an empty string for every record. Used with an appender that writes
+//to ioutil.Discard, or with a NullAppender, it removes formatting from the cost of logging so
+//that benchmarks measure the channel and processing overhead, see BenchmarkDiscardFormatter.
+func DiscardFormatter(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
+	return ""
+}
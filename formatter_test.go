@@ -11,6 +11,7 @@ func TestFormatFromString(t *testing.T) {
 	assert.Equal(t, FormatFromString("FuLl"), FULL, "formats are case insensitive")
 	assert.Equal(t, FormatFromString("SimplE"), SIMPLE, "formats are case insensitive")
 	assert.Equal(t, FormatFromString("MinimalTagged"), MINIMALTAGGED, "formats are case insensitive")
+	assert.Equal(t, FormatFromString("minimaltimed"), MINIMALTIMED, "should be minimal timed")
 	assert.Equal(t, FormatFromString("Minimal"), MINIMAL, "formats are case insensitive")
 	assert.Equal(t, FormatFromString("foo"), SIMPLE, "default is simple")
 }
@@ -20,6 +21,7 @@ func TestFormatGetFormatter(t *testing.T) {
 	assert.Equal(t, GetFormatter(SIMPLE), LogFormatter(simpleFormat), "should be simple")
 	assert.Equal(t, GetFormatter(MINIMALTAGGED), LogFormatter(minimalWithTagsFormat), "should be minimal tagged")
 	assert.Equal(t, GetFormatter(MINIMAL), LogFormatter(minimalFormat), "should be minimal")
+	assert.Equal(t, GetFormatter(MINIMALTIMED), LogFormatter(minimalTimedFormat), "should be minimal timed")
 	assert.Equal(t, GetFormatter(LogFormat("foo")), LogFormatter(simpleFormat), "should be simple")
 }
 
@@ -41,12 +43,48 @@ func TestFormatFull(t *testing.T) {
 	assert.Equal(t, fullFormat(INFO, []string{"one", "two"}, "hello", at, original), expected, fmt.Sprintf("should equal %s", expected))
 }
 
+func TestReplayMarker(t *testing.T) {
+	at := time.Unix(1000, 0)
+	original := at.AddDate(0, 0, 1)
+
+	SetReplayMarker(func(original time.Time) string {
+		return "replayed=true original=" + original.UTC().Format(time.RFC3339)
+	})
+	defer SetReplayMarker(nil)
+
+	expected := "[Dec 31 16:16:40.000] [INFO] replayed=true original=1970-01-02T00:16:40Z hello"
+	assert.Equal(t, fullFormat(INFO, nil, "hello", at, original), expected, fmt.Sprintf("should equal %s", expected))
+
+	SetReplayMarker(func(original time.Time) string { return "" })
+	expected = "[Dec 31 16:16:40.000] [INFO] hello"
+	assert.Equal(t, fullFormat(INFO, nil, "hello", at, original), expected, "an empty marker should leave the replay unmarked")
+
+	SetReplayMarker(nil)
+	expected = "[Dec 31 16:16:40.000] [INFO] [replayed from Jan  1 16:16:40.000] hello"
+	assert.Equal(t, fullFormat(INFO, nil, "hello", at, original), expected, "nil should restore the default marker")
+}
+
+func TestFormatMinimalTimed(t *testing.T) {
+
+	at := time.Unix(1000, 0)
+	original := at.AddDate(0, 0, 1)
+
+	expected := "Dec 31 16:16:40.000 hello"
+	assert.Equal(t, minimalTimedFormat(INFO, []string{"one", "two"}, "hello", at, original), expected, fmt.Sprintf("should equal %s", expected))
+
+	SetMinimalTimeLayout("15:04")
+	defer SetMinimalTimeLayout(time.StampMilli)
+
+	expected = "16:16 hello"
+	assert.Equal(t, minimalTimedFormat(INFO, nil, "hello", at, at), expected, "the layout should be used")
+}
+
 func TestFormatSimple(t *testing.T) {
 
 	at := time.Unix(1000, 0)
 	original := at.AddDate(0, 0, 1)
 
-	expected := "[Dec 31 16:16:40] [INFO] hello"
+	expected := "[Dec 31 16:16:40.000] [INFO] hello"
 	assert.Equal(t, simpleFormat(INFO, []string{"one", "two"}, "hello", at, original), expected, fmt.Sprintf("should equal %s", expected))
 	assert.Equal(t, simpleFormat(INFO, nil, "hello", at, original), expected, fmt.Sprintf("should equal %s", expected))
 	assert.Equal(t, simpleFormat(INFO, []string{"one", "two"}, "hello", at, at), expected, fmt.Sprintf("should equal %s", expected))
@@ -82,3 +120,88 @@ func TestFormatMinimalWithTags(t *testing.T) {
 	expected = "[INFO] [one two] hello"
 	assert.Equal(t, minimalWithTagsFormat(INFO, []string{"one", "two"}, "hello", at, original), expected, fmt.Sprintf("should equal %s", expected))
 }
+
+func TestSetDefaultFormatterWhileLogging(t *testing.T) {
+
+	memory := NewMemoryAppender()
+	record := NewLogRecord(nil, INFO, nil, "hello", time.Now(), time.Now())
+	done := make(chan bool)
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			memory.Log(record)
+		}
+		done <- true
+	}()
+
+	for i := 0; i < 100; i++ {
+		SetDefaultFormatter(GetFormatter(MINIMAL))
+	}
+
+	<-done
+	SetDefaultFormatter(GetFormatter(FULL))
+
+	assert.Equal(t, len(memory.GetLoggedMessages()), 100, "all records should be formatted")
+}
+
+func TestCompositeFormatter(t *testing.T) {
+
+	at := time.Unix(1000, 0)
+	empty := func(level LogLevel, tags []string, message string, t time.Time, original time.Time) string {
+		return ""
+	}
+
+	composite := CompositeFormatter(" | ", GetFormatter(MINIMALTAGGED), empty, GetFormatter(MINIMAL))
+
+	expected := "[INFO] [one two] hello | hello"
+	assert.Equal(t, composite(INFO, []string{"one", "two"}, "hello", at, at), expected, fmt.Sprintf("should equal %s", expected))
+
+	expected = ""
+	assert.Equal(t, CompositeFormatter(" | ")(INFO, nil, "hello", at, at), expected, "no formatters should produce an empty string")
+}
+
+func TestDiscardFormatter(t *testing.T) {
+	at := time.Unix(1000, 0)
+	assert.Equal(t, DiscardFormatter(INFO, []string{"one", "two"}, "hello", at, at), "", "discard should always be empty")
+}
+
+func TestAdaptFormatter(t *testing.T) {
+
+	at := time.Unix(1000, 0)
+	original := at.AddDate(0, 0, 1)
+	record := NewLogRecord(nil, INFO, []string{"one"}, "hello", at, original)
+
+	formatter := AdaptFormatter(fullFormat)
+	assert.Equal(t, formatter(record), fullFormat(INFO, []string{"one"}, "hello", at, at), "records that aren't replayed pass their time as the original")
+
+	record.Replayed = true
+	assert.Equal(t, formatter(record), fullFormat(INFO, []string{"one"}, "hello", at, original), "replayed records pass their original time")
+}
+
+func TestFullFormatUsesReplayed(t *testing.T) {
+
+	at := time.Unix(1000, 0)
+	record := NewLogRecord(nil, INFO, nil, "hello", at, at)
+	record.Replayed = true
+
+	memory := NewMemoryAppender()
+	memory.SetFormatter(GetFormatter(FULL))
+	memory.Log(record)
+
+	expected := "[Dec 31 16:16:40.000] [INFO] [replayed from Dec 31 16:16:40.000] hello"
+	assert.Equal(t, memory.GetLoggedMessages(), []string{expected}, "replayed records should be marked even if the times are equal")
+}
+
+func TestTagRendering(t *testing.T) {
+
+	SetTagSeparator(", ")
+	SetTagBrackets("<", ">")
+
+	formatted := minimalWithTagsFormat(INFO, []string{"one", "two"}, "hello", time.Now(), time.Now())
+
+	SetTagSeparator(" ")
+	SetTagBrackets("[", "]")
+
+	assert.Equal(t, formatted, "[INFO] <one, two> hello", "tags should use the separator and brackets")
+	assert.Equal(t, minimalWithTagsFormat(INFO, []string{"one", "two"}, "hello", time.Now(), time.Now()), "[INFO] [one two] hello", "the defaults match slice formatting")
+}
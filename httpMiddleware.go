@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+//LoggingMiddleware wraps a handler so that each request is logged with the logger when it completes, with the
+//method, path, status, bytes written and duration as key=value pairs. Requests are logged at INFO, responses
+//with a 5xx status are logged at ERROR. The tags are added to every message.
+func LoggingMiddleware(logger Logger, tags ...string) func(http.Handler) http.Handler {
+	return LoggingMiddlewareWithLevel(logger, INFO, tags...)
+}
+
+//LoggingMiddlewareWithLevel is like LoggingMiddleware but logs successful requests at the level,
+//responses with a 5xx status are still logged at ERROR
+func LoggingMiddlewareWithLevel(logger Logger, level LogLevel, tags ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(recorder, r)
+
+			status := recorder.status
+
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			requestLevel := level
+
+			if status >= 500 {
+				requestLevel = ERROR
+			}
+
+			logWithTagsf(logger, requestLevel, tags, "method=%s path=%s status=%d bytes=%d duration=%v",
+				r.Method, r.URL.Path, status, recorder.bytes, time.Since(start))
+		})
+	}
+}
+
+//levelLogger is implemented by loggers that can log at any level, like LoggerImpl
+type levelLogger interface {
+	LogWithTagsf(l LogLevel, tags []string, fmt string, args ...interface{})
+}
+
+//logWithTagsf logs at the level with the logger's level methods, if it can't log at any level
+func logWithTagsf(logger Logger, level LogLevel, tags []string, fmt string, args ...interface{}) {
+	if leveled, ok := logger.(levelLogger); ok {
+		leveled.LogWithTagsf(level, tags, fmt, args...)
+		return
+	}
+
+	switch {
+	case level >= ERROR:
+		logger.ErrorWithTagsf(tags, fmt, args...)
+	case level >= WARN:
+		logger.WarnWithTagsf(tags, fmt, args...)
+	case level >= INFO:
+		logger.InfoWithTagsf(tags, fmt, args...)
+	case level >= DEBUG:
+		logger.DebugWithTagsf(tags, fmt, args...)
+	default:
+		logger.VerboseWithTagsf(tags, fmt, args...)
+	}
+}
+
+//statusRecorder captures the status and size of a response, it forwards Flush, Hijack and Push, and
+//Unwrap lets http.ResponseController reach the wrapped writer, so streaming and websocket handlers work
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(b []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	n, err := recorder.ResponseWriter.Write(b)
+	recorder.bytes += int64(n)
+	return n, err
+}
+
+//Flush passes through to the wrapped writer, if it supports flushing
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//Hijack passes through to the wrapped writer, a hijacked request is logged with the status 101
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer %T doesn't support hijacking", recorder.ResponseWriter)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+
+	if err == nil && recorder.status == 0 {
+		recorder.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+//Push passes through to the wrapped writer, if it supports server push
+func (recorder *statusRecorder) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := recorder.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+//Unwrap returns the wrapped writer, for http.ResponseController
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	logger, memory := setup()
+	memory.SetFormatter(GetFormatter(MINIMALTAGGED))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	wrapped := LoggingMiddleware(logger, "http")(handler)
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/fail", nil))
+
+	WaitForIncoming()
+	messages := memory.GetLoggedMessages()
+	assert.Equal(t, len(messages), 2, "each request should be logged")
+	assert.True(t, strings.HasPrefix(messages[0], "[INFO] [http] method=GET path=/hello status=200 bytes=5 duration="), messages[0])
+	assert.True(t, strings.HasPrefix(messages[1], "[ERROR] [http] method=POST path=/fail status=500 bytes=0 duration="), messages[1])
+}
+
+func TestLoggingMiddlewareWithLevel(t *testing.T) {
+	logger, memory := setup()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := LoggingMiddlewareWithLevel(logger, DEBUG)(handler)
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "requests should be logged at the configured level")
+
+	logger.SetLogLevel(DEBUG)
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 1, "requests should be logged at the configured level")
+}
+
+func TestLoggingMiddlewareForwardsWriterInterfaces(t *testing.T) {
+	logger, memory := setup()
+	memory.SetFormatter(GetFormatter(MINIMAL))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			assert.Nil(t, http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute)), "the controller should reach the connection")
+			w.Write([]byte("part"))
+			_, ok := w.(http.Flusher)
+			assert.True(t, ok, "the writer should be a flusher")
+			w.(http.Flusher).Flush()
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		assert.Nil(t, err, "the connection should be hijacked")
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		rw.Flush()
+		conn.Close()
+	})
+
+	server := httptest.NewServer(LoggingMiddleware(logger)(handler))
+	defer server.Close()
+
+	for _, path := range []string{"/stream", "/hijack"} {
+		resp, err := http.Get(server.URL + path)
+		assert.Nil(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.True(t, len(body) > 0, "the handler should write a response")
+	}
+
+	//the server logs after the client has its response
+	for i := 0; i < 1000 && len(memory.GetLoggedMessages()) < 2; i++ {
+		time.Sleep(time.Millisecond)
+		WaitForIncoming()
+	}
+
+	messages := memory.GetLoggedMessages()
+	assert.Equal(t, len(messages), 2, "each request should be logged")
+	assert.True(t, strings.HasPrefix(messages[0], "method=GET path=/stream status=200 bytes=4 "), messages[0])
+	assert.True(t, strings.HasPrefix(messages[1], "method=GET path=/hijack status=101 "), messages[1])
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//LevelSource provides logger levels from outside the program, like a config service, so levels can
+//be controlled centrally. Level returns the level for the named logger, the default logger is named
+//"_default", and false if the source has no level for it. Returning DEFAULT is the same as returning false.
+type LevelSource interface {
+	Level(loggerName string) (LogLevel, bool)
+}
+
+//DefaultLevelSourceTTL is how long the level from a LevelSource is cached if no TTL is given
+const DefaultLevelSourceTTL = 10 * time.Second
+
+//levelSource holds the registered source and its cache, stored as a *sourcedLevels
+var levelSource atomic.Value
+
+//sourcedLevels caches the source's answers in an immutable map, replaced as a whole, so that level
+//checks only need an atomic load. m serializes the refreshes and the lookups of new loggers.
+type sourcedLevels struct {
+	source LevelSource
+	ttl    time.Duration
+	stop   chan struct{}
+
+	m      sync.Mutex
+	levels atomic.Value
+}
+
+type sourcedLevel struct {
+	level LogLevel
+	ok    bool
+}
+
+func init() {
+	levelSource.Store((*sourcedLevels)(nil))
+}
+
+/*
+SetLevelSource registers a source that is asked for each logger's level. A level from the source is
+used in place of the level set with SetLogLevel, tag levels still come first. Loggers the source has no
+level for use their own level as usual.
+
+Levels are cached, and a go routine started for the source asks it again about every logger it has
+seen once per ttl, or DefaultLevelSourceTTL if the ttl is 0 or less, so checking a level doesn't call
+the source or take a lock. The first check for a logger calls the source with the logging lock held,
+so the source should answer from memory, for example from values a background go routine polls, and
+must be safe for concurrent use. Buffers aren't flushed when the source's levels change. Pass nil to
+remove the source, which stops its go routine.
+*/
+func SetLevelSource(source LevelSource, ttl time.Duration) {
+	var levels *sourcedLevels
+
+	if source != nil {
+		if ttl <= 0 {
+			ttl = DefaultLevelSourceTTL
+		}
+
+		levels = &sourcedLevels{source: source, ttl: ttl, stop: make(chan struct{})}
+		levels.levels.Store(map[string]sourcedLevel{})
+	}
+
+	if previous := levelSource.Swap(levels).(*sourcedLevels); previous != nil {
+		close(previous.stop)
+	}
+
+	if levels != nil {
+		go levels.refresh()
+	}
+}
+
+//levelFromSource returns the level from the registered source for the logger, if there is one
+func levelFromSource(loggerName string) (LogLevel, bool) {
+	levels := levelSource.Load().(*sourcedLevels)
+
+	if levels == nil {
+		return DEFAULT, false
+	}
+
+	entry, found := levels.levels.Load().(map[string]sourcedLevel)[loggerName]
+
+	if !found {
+		entry = levels.lookup(loggerName)
+	}
+
+	return entry.level, entry.ok
+}
+
+//lookup asks the source about a logger that isn't cached yet and adds it to a copy of the cache
+func (levels *sourcedLevels) lookup(loggerName string) sourcedLevel {
+	levels.m.Lock()
+	defer levels.m.Unlock()
+
+	current := levels.levels.Load().(map[string]sourcedLevel)
+
+	if entry, found := current[loggerName]; found {
+		return entry
+	}
+
+	updated := make(map[string]sourcedLevel, len(current)+1)
+
+	for name, entry := range current {
+		updated[name] = entry
+	}
+
+	updated[loggerName] = levels.ask(loggerName)
+	levels.levels.Store(updated)
+
+	return updated[loggerName]
+}
+
+//refresh asks the source about every cached logger once per ttl, until the source is replaced
+func (levels *sourcedLevels) refresh() {
+	ticker := time.NewTicker(levels.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-levels.stop:
+			return
+		case <-ticker.C:
+			levels.m.Lock()
+			current := levels.levels.Load().(map[string]sourcedLevel)
+			updated := make(map[string]sourcedLevel, len(current))
+
+			for name := range current {
+				updated[name] = levels.ask(name)
+			}
+
+			levels.levels.Store(updated)
+			levels.m.Unlock()
+		}
+	}
+}
+
+func (levels *sourcedLevels) ask(loggerName string) sourcedLevel {
+	level, ok := levels.source.Level(loggerName)
+	return sourcedLevel{level: level, ok: ok && level != DEFAULT}
+}
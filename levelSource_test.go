@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapLevelSource struct {
+	m      sync.Mutex
+	levels map[string]LogLevel
+	calls  int
+}
+
+func (source *mapLevelSource) Level(loggerName string) (LogLevel, bool) {
+	source.m.Lock()
+	defer source.m.Unlock()
+
+	source.calls++
+	level, ok := source.levels[loggerName]
+	return level, ok
+}
+
+func (source *mapLevelSource) set(loggerName string, level LogLevel) {
+	source.m.Lock()
+	source.levels[loggerName] = level
+	source.m.Unlock()
+}
+
+func TestLevelSource(t *testing.T) {
+	logger, _ := setupImpl()
+	named := logger.name
+	source := &mapLevelSource{levels: map[string]LogLevel{named: ERROR}}
+
+	SetLevelSource(source, time.Hour)
+	defer SetLevelSource(nil, 0)
+
+	assert.False(t, logger.CheckLevel(WARN, nil), "the source's level should be used")
+	assert.Equal(t, logger.Level(), ERROR, "the source's level is the effective level")
+	assert.True(t, CheckLevel(INFO, nil), "loggers the source doesn't know keep their level")
+
+	source.set(named, DEBUG)
+	assert.False(t, logger.CheckLevel(WARN, nil), "the level should be cached")
+
+	SetLevelSource(source, time.Millisecond)
+	assert.True(t, logger.CheckLevel(DEBUG, nil), "a new source is asked again")
+	calls := source.calls
+
+	source.set("_default", WARN)
+	source.set(named, DEFAULT)
+	assert.True(t, waitFor(func() bool { return !logger.CheckLevel(INFO, nil) }), "a logger without a level falls back to the default logger's level from the source")
+	source.m.Lock()
+	assert.True(t, source.calls > calls, "the cached levels should be refreshed in the background")
+	source.m.Unlock()
+}
+
+func BenchmarkLevelSourceCheckLevel(b *testing.B) {
+	logger := GetLogger("levelsourcebench")
+	SetLevelSource(&mapLevelSource{levels: map[string]LogLevel{"levelsourcebench": INFO}}, time.Hour)
+	defer SetLevelSource(nil, 0)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.CheckLevel(DEBUG, nil)
+		}
+	})
+}
+
+//waitFor polls the condition for up to a second
+func waitFor(condition func() bool) bool {
+	for i := 0; i < 1000; i++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return condition()
+}
@@ -15,33 +15,42 @@ import (
 	"container/ring"
 	"fmt"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 //Logger is the interface for the objects that are the target of logging messages. Logging methods
-//imply a level. For example, Info() implies a level of LogLevel.INFO.
+//imply a level. For example, Info() implies a level of LogLevel.INFO. Methods for narrower uses,
+//like LogAt, LogAndConfirm, Disable and the KV helpers, are only on LoggerImpl so that adding them
+//doesn't break other implementations of Logger, GetLogger's result can be asserted to *LoggerImpl.
 type Logger interface {
 	ErrorWithTagsf(tags []string, fmt string, args ...interface{})
 	ErrorWithTags(tags []string, args ...interface{})
 	Errorf(fmt string, args ...interface{})
 	Error(args ...interface{})
+	Errorln(args ...interface{})
 
 	WarnWithTagsf(tags []string, fmt string, args ...interface{})
 	WarnWithTags(tags []string, args ...interface{})
 	Warnf(fmt string, args ...interface{})
 	Warn(args ...interface{})
+	Warnln(args ...interface{})
 
 	InfoWithTagsf(tags []string, fmt string, args ...interface{})
 	InfoWithTags(tags []string, args ...interface{})
 	Infof(fmt string, args ...interface{})
 	Info(args ...interface{})
+	Infoln(args ...interface{})
 
 	DebugWithTagsf(tags []string, fmt string, args ...interface{})
 	DebugWithTags(tags []string, args ...interface{})
 	Debugf(fmt string, args ...interface{})
 	Debug(args ...interface{})
+	Debugln(args ...interface{})
 
 	VerboseWithTagsf(tags []string, fmt string, args ...interface{})
 	Verbosef(fmt string, args ...interface{})
@@ -49,8 +58,12 @@ type Logger interface {
 	SetLogLevel(l LogLevel)
 	SetTagLevel(tag string, l LogLevel)
 	CheckLevel(l LogLevel, tags []string) bool
+	Level() LogLevel
 
 	SetBufferLength(length int)
+	FlushBuffer()
+
+	Clone() Logger
 }
 
 const (
@@ -65,23 +78,63 @@ var logMutex = new(sync.RWMutex)
 //defaultLogger is provided for most logging situations
 var defaultLogger *LoggerImpl
 
-//The default format is used to determine how appenders without a custom format log their messages
-var defaultFormatter = GetFormatter(FULL)
+//The default format is used to determine how appenders without a custom format log their messages,
+//appenders read it without holding the logging lock so it is stored as an atomic value
+var defaultFormatter atomic.Value
+
+//Loggers share the appenders, the list is never modified in place, changes store a new
+//slice so that readers can use a snapshot without holding the lock
+var appenders atomic.Value
 
-//Loggers share the appenders
-var appenders = make([]LogAppender, 0)
+//appenderLevels caches which levels at least one appender accepts, it is rebuilt when
+//appenderGeneration changes, which happens when the appenders or their levels change
+var appenderLevels atomic.Value
+var appenderGeneration uint64
 
 //The package maintains a map of named loggers
 var loggers = make(map[string]*LoggerImpl)
+
+//Messages with a muted tag are dropped by every logger
+var mutedTags = make(map[string]bool)
+
+//tagBuffers hold records with a buffered tag from every logger, like the logger buffers
+//they are only changed by the logging go routine or while holding the lock
+var tagBuffers = make(map[string]*tagBuffer)
+
+type tagBuffer struct {
+	records *ring.Ring
+}
+
+//flushHook is called after a logger's buffer is flushed
+var flushHook func(loggerName string, count int)
 var incomingChannel = make(chan *LogRecord, 2048)
 var stateChannel = make(chan int, 0)
 var waiter = new(sync.WaitGroup)
 var logged uint64
 var processed uint64
+var dropped uint64
+var sheddingDepth int64
+var sheddingLevel int32
 var logErrors chan<- error
+var logEvents chan<- LoggingEvent
 var enableVerbose int32
+var appendersPaused int32
+var synchronous int32
+var maxMessageLength int64
+var strictTags int32
+var stackCaptureLevel int32
+
+//processMutex makes sure that only one go routine processes records, records are processed by
+//the logging go routine and, in synchronous mode, by the go routines that log them
+var processMutex = new(sync.Mutex)
+
+//ambientTags holds the optional func() []string used to add tags to every message
+var ambientTags atomic.Value
 
 func init() {
+	defaultFormatter.Store(GetFormatter(FULL))
+	storeAppenders(make([]LogAppender, 0))
+
 	defaultLogger = new(LoggerImpl)
 	defaultLogger.name = "_default"
 	defaultLogger.level = INFO
@@ -90,6 +143,7 @@ func init() {
 	AddAppender(NewStdErrAppender())
 	AdaptStandardLogging(INFO, nil)
 
+	waiter.Add(1)
 	go processIncoming()
 }
 
@@ -108,6 +162,31 @@ type LogRecord struct {
 	Message string
 	//Logger is the logger associated with this log record, if any
 	Logger *LoggerImpl
+	//Seq is a monotonically increasing number assigned when the record is logged,
+	//replayed records keep their original sequence number
+	Seq uint64
+	//Replayed is true when the record was logged from a buffer
+	Replayed bool
+	//Stack is the call stack where the record was logged, for records at or above the stack capture level
+	Stack string
+	//Frames is the same call stack as Stack, one frame per entry, for appenders like error trackers that
+	//need the structured stack
+	Frames []runtime.Frame
+
+	//confirm receives the outcome the first time the record is processed, for LogAndConfirm
+	confirm chan error
+	//skipLevel is set on records replayed from a tag buffer, they are logged without checking the levels again
+	skipLevel bool
+}
+
+//LoggingEvent describes an error that occurred during the logging process
+type LoggingEvent struct {
+	//Err is the error that occurred
+	Err error
+	//Record is the record being logged when the error occurred, if any
+	Record *LogRecord
+	//Appender is the appender that returned the error, if any
+	Appender LogAppender
 }
 
 //LoggerImpl stores the data for a logger.
@@ -117,35 +196,180 @@ type LoggerImpl struct {
 	level     LogLevel
 	tagLevels map[string]LogLevel
 	buffer    *ring.Ring
+	disabled  int32
 }
 
+//pauseMutex orders the state changes, so that an automatic restart can't undo a later pause,
+//it protects pauseGeneration, maxPause and loggingStopped
+var pauseMutex sync.Mutex
+var pauseGeneration uint64
+var maxPause time.Duration
+var loggingStopped bool
+
+//loggingPaused is 1 while logging is paused, it is atomic so Healthy can read it without the pause mutex
+var loggingPaused int32
+
 //PauseLogging stops all logging from being processed.
 //Pause will not wait for all log messages to be processed
 func PauseLogging() {
+	pauseFor(0)
+}
+
+//PauseFor pauses logging like PauseLogging, and restarts it after the duration unless logging
+//was restarted, paused again or stopped in the meantime
+func PauseFor(d time.Duration) {
+	pauseFor(d)
+}
+
+//SetMaxPause limits how long any pause can last, so that a code path that forgets to call RestartLogging
+//doesn't stop logging forever. When the limit is reached logging is restarted and an error is sent to
+//the error channel. The limit applies to pauses that start after it is set, 0 removes it.
+func SetMaxPause(d time.Duration) {
+	pauseMutex.Lock()
+	maxPause = d
+	pauseMutex.Unlock()
+}
+
+func pauseFor(d time.Duration) {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+
 	stateChannel <- paused
+	atomic.StoreInt32(&loggingPaused, 1)
+	pauseGeneration++
+	generation := pauseGeneration
+
+	limit, forced := d, false
+
+	if maxPause > 0 && (limit <= 0 || maxPause < limit) {
+		limit, forced = maxPause, true
+	}
+
+	if limit > 0 {
+		time.AfterFunc(limit, func() { resumeAfterPause(generation, limit, forced) })
+	}
+}
+
+//resumeAfterPause restarts logging if nothing has changed the state since the pause
+func resumeAfterPause(generation uint64, after time.Duration, forced bool) {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+
+	if generation != pauseGeneration || loggingStopped {
+		return
+	}
+
+	stateChannel <- running
+	atomic.StoreInt32(&loggingPaused, 0)
+	pauseGeneration++
+
+	if forced {
+		reportError(fmt.Errorf("logging was paused for %v without being restarted, it has been restarted", after))
+	}
 }
 
 //RestartLogging starts messages logging again
 func RestartLogging() {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+
 	stateChannel <- running
+	atomic.StoreInt32(&loggingPaused, 0)
+	pauseGeneration++
+}
+
+//DefaultStopGracePeriod is how long StopLogging spends processing queued records by default
+const DefaultStopGracePeriod = 5 * time.Second
+
+//stopGracePeriod is read by the logging go routine when it stops, so it is stored atomically
+var stopGracePeriod = int64(DefaultStopGracePeriod)
+
+//SetStopGracePeriod changes how long StopLogging spends processing the records that are already queued,
+//including records queued while logging is paused, before the logging go routine exits. 0 or less stops
+//without processing them.
+func SetStopGracePeriod(d time.Duration) {
+	atomic.StoreInt64(&stopGracePeriod, int64(d))
 }
 
 //StopLogging can only be called once, and completely stops the logging
-//process
+//process. The records that are already queued are processed first, for up
+//to the grace period, and an error is reported if any are left.
 func StopLogging() {
+	stopLogging(time.Duration(atomic.LoadInt64(&stopGracePeriod)))
+}
+
+//stopGrace passes the grace period for the current stop to the logging go routine
+var stopGrace int64
+
+func stopLogging(grace time.Duration) {
+	pauseMutex.Lock()
+	atomic.StoreInt64(&stopGrace, int64(grace))
 	stateChannel <- stopped
+	loggingStopped = true
+	pauseMutex.Unlock()
+
 	waiter.Wait()
 }
 
+//draining is set by StopAndDrain, after which records are no longer queued
+var draining int32
+var sending int32
+
+//StopAndDrain stops logging like StopLogging, and returns the records that were queued but not processed,
+//oldest first, so that they can be written somewhere else during shutdown. Records logged after it is called
+//are discarded instead of being queued, except in synchronous mode. The returned and discarded records count
+//as processed for WaitForIncoming. Like StopLogging it can only be called once, and not after StopLogging.
+func StopAndDrain() []*LogRecord {
+	stopLogging(0)
+	atomic.StoreInt32(&draining, 1)
+
+	var records []*LogRecord
+
+	for {
+		select {
+		case record, ok := <-incomingChannel:
+			if !ok {
+				return records
+			}
+			records = append(records, record)
+			atomic.AddUint64(&processed, 1)
+		default:
+			if atomic.LoadInt32(&sending) == 0 {
+				return records
+			}
+			runtime.Gosched()
+		}
+	}
+}
+
 func processIncoming() {
+	batch := make([]*LogRecord, 0, DefaultProcessBatchSize)
 loop:
 	for {
 		select {
-		case record := <-incomingChannel:
-			processLogRecord(record)
+		case record, ok := <-incomingChannel:
+			if !ok { //nothing else can be logged
+				waiter.Done()
+				break loop
+			}
+			batch, ok = drainIncoming(append(batch, record))
+			processMutex.Lock()
+			processLogRecords(batch)
+			processMutex.Unlock()
+
+			for i := range batch {
+				batch[i] = nil
+			}
+			batch = batch[:0]
+
+			if !ok {
+				waiter.Done()
+				break loop
+			}
 		case newState := <-stateChannel:
 			switch newState {
 			case stopped:
+				processOnStop(batch)
 				waiter.Done()
 				break loop
 			case paused: //run a sub-loop looking for a state change
@@ -155,6 +379,7 @@ loop:
 					case state := <-stateChannel:
 						switch state {
 						case stopped:
+							processOnStop(batch)
 							waiter.Done()
 							break loop
 						case running:
@@ -169,6 +394,84 @@ loop:
 	}
 }
 
+//processOnStop processes the records that are already queued until the channel is empty or the
+//grace period runs out, the deadline is only checked between batches
+func processOnStop(batch []*LogRecord) {
+	grace := time.Duration(atomic.LoadInt64(&stopGrace))
+
+	if grace <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(grace)
+	ok := true
+
+	for ok && time.Now().Before(deadline) {
+		batch, ok = drainIncoming(batch[:0])
+
+		if len(batch) == 0 {
+			return
+		}
+
+		processMutex.Lock()
+		processLogRecords(batch)
+		processMutex.Unlock()
+	}
+
+	if remaining := len(incomingChannel); remaining > 0 {
+		reportError(fmt.Errorf("logging stopped after %v with %d records still queued", grace, remaining))
+	}
+}
+
+//DefaultProcessBatchSize is the most queued records the logging go routine processes together by default
+const DefaultProcessBatchSize = 64
+
+var processBatchSize int32 = DefaultProcessBatchSize
+
+//SetProcessBatchSize sets the most records the logging go routine takes from the queue at once. The records
+//are level checked and written to the appenders under one lock, and BatchAppenders get them in one call.
+//It never waits for a batch to fill, only records that are already queued are taken. A size of 1 or less
+//processes records one at a time.
+func SetProcessBatchSize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	atomic.StoreInt32(&processBatchSize, int32(size))
+}
+
+//drainIncoming adds records that are already queued to the batch, without waiting for more,
+//it returns false if the channel was closed
+func drainIncoming(batch []*LogRecord) ([]*LogRecord, bool) {
+	limit := int(atomic.LoadInt32(&processBatchSize))
+
+	for len(batch) < limit {
+		select {
+		case record, ok := <-incomingChannel:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, record)
+		default:
+			return batch, true
+		}
+	}
+
+	return batch, true
+}
+
+//PauseAppenders stops records from being sent to the appenders, while processing continues.
+//Records that pass their logger's level are put in the logger's buffer instead, if it has one,
+//so that they can be replayed later. Unlike PauseLogging, callers are never blocked by a full channel.
+func PauseAppenders() {
+	atomic.StoreInt32(&appendersPaused, 1)
+}
+
+//ResumeAppenders sends records to the appenders again, records buffered while the appenders
+//were paused are not replayed until the logger's buffer is flushed.
+func ResumeAppenders() {
+	atomic.StoreInt32(&appendersPaused, 0)
+}
+
 //WaitForIncoming should be used in tests or system shutdowns to make sure
 //that all of the log messages pushed into the logging channel are processed
 //and appended appropriately.
@@ -183,18 +486,106 @@ func WaitForIncoming() {
 	}
 }
 
+//DefaultHealthThreshold is how long the logging go routine can go without progress before Healthy returns false
+const DefaultHealthThreshold = 30 * time.Second
+
+//healthMutex protects the progress Healthy has seen between calls
+var healthMutex sync.Mutex
+var healthThreshold = DefaultHealthThreshold
+var lastSeenProcessed uint64
+var stalledSince time.Time
+
+//SetHealthThreshold changes how long Healthy waits without progress before reporting a problem
+func SetHealthThreshold(d time.Duration) {
+	healthMutex.Lock()
+	healthThreshold = d
+	healthMutex.Unlock()
+}
+
+//Healthy returns false if the logging go routine looks stuck, because records are waiting and none have
+//been processed for longer than the health threshold. It is meant to be called regularly by a health check,
+//progress is compared with the previous call, so a stuck go routine is reported by the first call at least
+//the threshold after a call that saw it waiting. Logging that is paused on purpose is healthy.
+func Healthy() bool {
+	currentProcessed := atomic.LoadUint64(&processed)
+	currentLogged := atomic.LoadUint64(&logged)
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	if currentProcessed >= currentLogged || currentProcessed != lastSeenProcessed || atomic.LoadInt32(&loggingPaused) == 1 {
+		lastSeenProcessed = currentProcessed
+		stalledSince = time.Time{}
+		return true
+	}
+
+	if stalledSince.IsZero() {
+		stalledSince = time.Now()
+	}
+
+	return time.Since(stalledSince) < healthThreshold
+}
+
+//SetLoadShedding allows low severity messages to be dropped when the logging channel backs up.
+//Once depth records are waiting to be processed, messages below level are dropped when they are
+//logged instead of being queued, so that higher severity messages keep flowing during a storm.
+//Replayed messages are never dropped. A depth of 0, the default, turns shedding off.
+func SetLoadShedding(depth int, level LogLevel) {
+	atomic.StoreInt32(&sheddingLevel, int32(level))
+	atomic.StoreInt64(&sheddingDepth, int64(depth))
+}
+
+//DroppedCount returns the number of messages dropped by load shedding
+func DroppedCount() uint64 {
+	return atomic.LoadUint64(&dropped)
+}
+
+//shouldShed checks the load shedding settings against the current channel depth
+func shouldShed(level LogLevel) bool {
+	depth := atomic.LoadInt64(&sheddingDepth)
+
+	if depth <= 0 {
+		return false
+	}
+
+	//count the batch the logging go routine is working on as well as the channel,
+	//processed is loaded first so the difference can't underflow
+	done := atomic.LoadUint64(&processed)
+	waiting := atomic.LoadUint64(&logged) - done
+
+	if waiting < uint64(depth) {
+		return false
+	}
+
+	return level < LogLevel(atomic.LoadInt32(&sheddingLevel))
+}
+
 //CaptureLoggingErrors allows the logging user to provide a channel
 //for capturing logging errors. Any error during the logging process, like an
 //appender failing will be sent to this channel.
 //By default there is no error channel.
 //Logging will not block when writting to the error channel so make sure the
-//channel is big enough to capture errors
+//channel is big enough to capture errors.
+//The channel should not be closed while it is registered, call CaptureLoggingErrors(nil)
+//first, once it returns the channel is no longer used and can be closed. If a registered
+//channel is closed anyway, errors sent to it are dropped instead of panicking.
 func CaptureLoggingErrors(errs chan<- error) {
 	logMutex.Lock()
 	logErrors = errs
 	logMutex.Unlock()
 }
 
+//CaptureLoggingEvents allows the logging user to provide a channel for capturing
+//logging errors along with the record and appender involved. Like CaptureLoggingErrors,
+//logging will not block when writing to the event channel. Both channels can be set,
+//in which case each error is sent to both. The event channel should be unregistered
+//before it is closed, in the same way as the error channel.
+func CaptureLoggingEvents(events chan<- LoggingEvent) {
+	logMutex.Lock()
+	logEvents = events
+	logMutex.Unlock()
+}
+
 //DefaultLogger returns a logger that can be used when a named logger isn't required
 func DefaultLogger() Logger {
 	return defaultLogger
@@ -208,12 +599,16 @@ func GetLogger(name string) Logger {
 	logMutex.RUnlock()
 
 	if logger == nil {
-		logger = new(LoggerImpl)
-		logger.name = name
-		logger.level = DEFAULT
-		logger.SetBufferLength(defaultLogger.buffer.Len())
 		logMutex.Lock()
-		loggers[name] = logger
+		logger = loggers[name]
+
+		if logger == nil { //check again, another go routine could have created it
+			logger = new(LoggerImpl)
+			logger.name = name
+			logger.level = DEFAULT
+			logger.setBufferLengthImpl(defaultLogger.buffer.Len())
+			loggers[name] = logger
+		}
 		logMutex.Unlock()
 	}
 
@@ -232,6 +627,36 @@ func DisableVerboseLogging() {
 	atomic.StoreInt32(&enableVerbose, 0)
 }
 
+//SetAmbientTagProvider registers a function that is called each time a message is logged, the tags it
+//returns are added to the message's tags. This is an advanced feature meant for call paths that can't be
+//given a logger, like pulling a request id from goroutine local storage. The provider is called by the
+//go routine doing the logging for every message, so it adds cost to each call and must be safe for concurrent use.
+//Pass nil to remove the provider.
+func SetAmbientTagProvider(provider func() []string) {
+	ambientTags.Store(provider)
+}
+
+//withAmbientTags returns the tags merged with those from the ambient tag provider, if there is one,
+//the tags passed in are never modified
+func withAmbientTags(tags []string) []string {
+	provider, _ := ambientTags.Load().(func() []string)
+
+	if provider == nil {
+		return tags
+	}
+
+	extra := provider()
+
+	if len(extra) == 0 {
+		return tags
+	}
+
+	merged := make([]string, 0, len(tags)+len(extra))
+	merged = append(merged, tags...)
+	merged = append(merged, extra...)
+	return merged
+}
+
 //SetDefaultLogLevel sets the default loggers log level, flushes all buffers in case messages are cleared for logging
 func SetDefaultLogLevel(l LogLevel) {
 	defaultLogger.SetLogLevel(l)
@@ -242,11 +667,24 @@ func SetDefaultTagLogLevel(tag string, l LogLevel) {
 	defaultLogger.SetTagLevel(tag, l)
 }
 
+//ClearDefaultTagLogLevel removes the default loggers level for the specified tag, flushes all buffers in case messages are cleared for logging
+func ClearDefaultTagLogLevel(tag string) {
+	defaultLogger.ClearTagLevel(tag)
+}
+
+//ClearDefaultTagLogLevels removes all of the default loggers tag levels, flushes all buffers in case messages are cleared for logging
+func ClearDefaultTagLogLevels() {
+	defaultLogger.ClearTagLevels()
+}
+
 //SetDefaultFormatter sets the default formatter used by appenders that don't have their own
 func SetDefaultFormatter(formatter LogFormatter) {
-	logMutex.Lock()
-	defaultFormatter = formatter
-	logMutex.Unlock()
+	defaultFormatter.Store(formatter)
+}
+
+//getDefaultFormatter returns the current default formatter, it does not require the lock
+func getDefaultFormatter() LogFormatter {
+	return defaultFormatter.Load().(LogFormatter)
 }
 
 //SetDefaultBufferLength sets the buffer length for the default logger, new loggers will use this length.
@@ -265,28 +703,132 @@ func SetDefaultBufferLength(length int) {
 	logMutex.Unlock()
 }
 
+//DisableBuffering removes the buffers from every logger, including the default logger so new loggers don't
+//get one, and removes the tag buffers. Buffered records are dropped without being logged. Records that don't
+//pass their levels are then discarded, with no replay. Calling SetDefaultBufferLength turns buffering back on.
+func DisableBuffering() {
+	logMutex.Lock()
+	defaultLogger.setBufferLengthImpl(0)
+
+	for _, val := range loggers {
+		val.setBufferLengthImpl(0)
+	}
+
+	tagBuffers = make(map[string]*tagBuffer)
+	logMutex.Unlock()
+}
+
 //AddAppender adds a new global appender for use by all loggers. Levels can be used to restrict logging to specific appenders.
 func AddAppender(appender LogAppender) {
 	logMutex.Lock()
-	appenders = append(appenders, appender)
+	current := currentAppenders()
+	updated := make([]LogAppender, 0, len(current)+1)
+	updated = append(updated, current...)
+	updated = append(updated, appender)
+	storeAppenders(updated)
 	logMutex.Unlock()
 }
 
+//storeAppenders replaces the appender list and invalidates the cached appender levels
+func storeAppenders(list []LogAppender) {
+	appenders.Store(list)
+	atomic.AddUint64(&appenderGeneration, 1)
+}
+
+//currentAppenders returns a snapshot of the appender list, it does not require the lock.
+//The returned slice must not be modified.
+func currentAppenders() []LogAppender {
+	return appenders.Load().([]LogAppender)
+}
+
 //ClearAppenders removes all of the global appenders, mainly used during configuration.
 //Will pause and restart logging
 func ClearAppenders() {
 	PauseLogging()
 	logMutex.Lock()
-	for _, appender := range appenders {
+	for _, appender := range currentAppenders() {
 		if app, ok := appender.(ClosableAppender); ok {
 			app.Close()
 		}
 	}
-	appenders = make([]LogAppender, 0)
+	storeAppenders(make([]LogAppender, 0))
 	logMutex.Unlock()
 	RestartLogging()
 }
 
+//Sync waits for the queued records to be processed, like WaitForIncoming, then asks each appender that
+//implements SyncableAppender to write its data to durable storage, for example with an fsync. It is meant
+//to be deferred in main, so it shouldn't be called while logging is paused. All of the appenders are synced,
+//the first error is returned.
+func Sync() error {
+	WaitForIncoming()
+
+	logMutex.RLock()
+	defer logMutex.RUnlock()
+
+	var firstErr error
+
+	for _, appender := range currentAppenders() {
+		if app, ok := appender.(SyncableAppender); ok {
+			if err := app.Sync(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+//ReplaceAppenders swaps the global appenders for the new list in one step, so no record is processed while
+//only some of the new appenders are in place. Old appenders that implement ClosableAppender are closed, unless
+//they are also in the new list. The list is copied, so it can be reused.
+func ReplaceAppenders(newAppenders []LogAppender) {
+	updated := make([]LogAppender, len(newAppenders))
+	copy(updated, newAppenders)
+
+	logMutex.Lock()
+	replaceAppenders(updated)
+	logMutex.Unlock()
+}
+
+//replaceAppenders expects the logging lock to be held, it stores the list, which must not be
+//modified afterwards, and closes the old appenders that aren't in it
+func replaceAppenders(updated []LogAppender) {
+	kept := make(map[LogAppender]bool, len(updated))
+	for _, appender := range updated {
+		kept[appender] = true
+	}
+
+	old := currentAppenders()
+	storeAppenders(updated)
+
+	for _, appender := range old {
+		if app, ok := appender.(ClosableAppender); ok && !kept[appender] {
+			app.Close()
+		}
+	}
+}
+
+//VerifyAppenders asks each appender that implements VerifiableAppender to check its configuration,
+//so that problems like an unwritable log file can be found at startup instead of when the first message
+//is logged. The errors from the appenders that fail are returned, appenders without a Verify method are skipped.
+func VerifyAppenders() []error {
+	logMutex.RLock()
+	defer logMutex.RUnlock()
+
+	var errs []error
+
+	for _, appender := range currentAppenders() {
+		if app, ok := appender.(VerifiableAppender); ok {
+			if err := app.Verify(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
 //ClearLoggers is provided so that an application can
 //completely reset its logging configuration, for example
 //on a SIGHUP
@@ -298,6 +840,36 @@ func ClearLoggers() {
 	RestartLogging()
 }
 
+//MuteTag drops every message with the tag, from every logger, regardless of levels. Muted
+//messages are not buffered. This overrides all tag and logger levels until UnmuteTag is called.
+func MuteTag(tag string) {
+	logMutex.Lock()
+	mutedTags[tag] = true
+	logMutex.Unlock()
+}
+
+//UnmuteTag allows messages with the tag to be logged again, based on the normal levels
+func UnmuteTag(tag string) {
+	logMutex.Lock()
+	delete(mutedTags, tag)
+	logMutex.Unlock()
+}
+
+//requires the lock be acquired
+func isMuted(tags []string) bool {
+	if len(mutedTags) == 0 {
+		return false
+	}
+
+	for _, tag := range tags {
+		if mutedTags[tag] {
+			return true
+		}
+	}
+
+	return false
+}
+
 /*
 AddTag creates a new array and adds a string to it. This insures that no
 slices are shared for tags.
@@ -305,10 +877,64 @@ slices are shared for tags.
 func AddTag(tags []string, newTag string) []string {
 	newTags := make([]string, 0, len(tags)+1)
 	newTags = append(newTags, tags...)
+
+	if atomic.LoadInt32(&strictTags) == 1 && !validTag(newTag) {
+		reportError(fmt.Errorf("empty tag %q was not added", newTag))
+		return newTags
+	}
+
 	newTags = append(newTags, newTag)
 	return newTags
 }
 
+//SetStrictTags turns on validation of tags, empty or whitespace only tags are removed from messages and
+//from AddTag, and each removal is reported to the error channel. Tags are not validated by default.
+func SetStrictTags(strict bool) {
+	if strict {
+		atomic.StoreInt32(&strictTags, 1)
+	} else {
+		atomic.StoreInt32(&strictTags, 0)
+	}
+}
+
+func validTag(tag string) bool {
+	return strings.TrimSpace(tag) != ""
+}
+
+//recordTags adds the ambient tags and, with strict tags, removes invalid ones, the tags passed in are never modified
+func recordTags(tags []string) []string {
+	tags = withAmbientTags(tags)
+
+	if atomic.LoadInt32(&strictTags) != 1 {
+		return tags
+	}
+
+	for i, tag := range tags {
+		if !validTag(tag) {
+			valid := make([]string, i, len(tags))
+			copy(valid, tags[:i])
+
+			for _, tag := range tags[i:] {
+				if validTag(tag) {
+					valid = append(valid, tag)
+				}
+			}
+
+			reportError(fmt.Errorf("%d empty tags were removed from a message", len(tags)-len(valid)))
+			return valid
+		}
+	}
+
+	return tags
+}
+
+//reportError sends an error to the error channels from outside the logging lock
+func reportError(err error) {
+	logMutex.RLock()
+	logError(err)
+	logMutex.RUnlock()
+}
+
 //SetLogLevel sets the level of messages allowed for a logger. This level can be
 //overriden for specific tags using SetTagLevel. Changing the level for a Logger
 //flushes its buffer in case messages are now free to be logged. This means that
@@ -316,7 +942,14 @@ func AddTag(tags []string, newTag string) []string {
 func (logger *LoggerImpl) SetLogLevel(l LogLevel) {
 	logMutex.Lock()
 	logger.level = l
+	wait := logger.flushAfterLevelChange()
+	logMutex.Unlock()
+	wait.Wait()
+}
 
+//flushAfterLevelChange expects the logging lock to be held, it flushes the buffers that
+//could be affected by a level change on the logger, all of them for the default logger
+func (logger *LoggerImpl) flushAfterLevelChange() *sync.WaitGroup {
 	wait := new(sync.WaitGroup)
 
 	if logger == defaultLogger {
@@ -325,41 +958,385 @@ func (logger *LoggerImpl) SetLogLevel(l LogLevel) {
 		wait.Add(1)
 		logger.flushBuffer(wait)
 	}
-	logMutex.Unlock()
-	wait.Wait()
+
+	return wait
+}
+
+//DefaultLevel returns the default loggers log level
+func DefaultLevel() LogLevel {
+	return defaultLogger.Level()
+}
+
+//Level returns the effective level for the logger, a logger with the DEFAULT level reports the
+//default loggers level. A level from the level source takes priority. Tag levels are not considered.
+func (logger *LoggerImpl) Level() LogLevel {
+	logMutex.RLock()
+	defer logMutex.RUnlock()
+
+	return logger.effectiveLevel()
 }
 
 //SetTagLevel assigns a log level to a specific tag. This level can override the general
-//level for a logger allowing specific log messages to slip through and be appended to the logs
+//level for a logger allowing specific log messages to slip through and be appended to the logs.
+//Tag levels are kept until they are cleared, so avoid setting them for dynamically generated tags,
+//like request ids, or clear them with ClearTagLevel when they are no longer needed.
 func (logger *LoggerImpl) SetTagLevel(tag string, l LogLevel) {
 	logMutex.Lock()
 	if logger.tagLevels == nil {
 		logger.tagLevels = make(map[string]LogLevel)
 	}
 	logger.tagLevels[tag] = l
-	wait := new(sync.WaitGroup)
-	if logger == defaultLogger {
-		flushAllLoggers(wait)
+	wait := logger.flushAfterLevelChange()
+	logMutex.Unlock()
+	wait.Wait()
+}
+
+//ClearTagLevel removes the level for a tag, so messages with the tag use the general level again.
+//Like SetTagLevel, it flushes the buffer in case messages are now free to be logged.
+func (logger *LoggerImpl) ClearTagLevel(tag string) {
+	logMutex.Lock()
+	delete(logger.tagLevels, tag)
+	wait := logger.flushAfterLevelChange()
+	logMutex.Unlock()
+	wait.Wait()
+}
+
+//ClearTagLevels removes all of the logger's tag levels, and flushes the buffer like SetTagLevel
+func (logger *LoggerImpl) ClearTagLevels() {
+	logMutex.Lock()
+	logger.tagLevels = nil
+	wait := logger.flushAfterLevelChange()
+	logMutex.Unlock()
+	wait.Wait()
+}
+
+//Disable silences the logger without changing its level. Nothing it logs is queued or buffered, whatever the
+//level and tags, and CheckLevel returns false. Queued records from the logger are dropped when they are processed.
+func (logger *LoggerImpl) Disable() {
+	atomic.StoreInt32(&logger.disabled, 1)
+}
+
+//Enable undoes Disable, the logger uses its levels again
+func (logger *LoggerImpl) Enable() {
+	atomic.StoreInt32(&logger.disabled, 0)
+}
+
+//Enabled returns false while the logger is disabled
+func (logger *LoggerImpl) Enabled() bool {
+	return atomic.LoadInt32(&logger.disabled) == 0
+}
+
+//SetBufferLength clears the buffer and creates a new one of the specified length. A length of 0 removes
+//the buffer, a negative length is reported to the error channel and treated as 0.
+func (logger *LoggerImpl) SetBufferLength(length int) {
+	logMutex.Lock()
+
+	logger.setBufferLengthImpl(length)
+
+	logMutex.Unlock()
+}
+
+//maxStackFrames limits the stacks captured for records at or above the stack capture level
+const maxStackFrames = 32
+
+//SetStackCaptureLevel adds the call stack to every record logged at or above the level, in the record's Stack
+//and Frames fields. Appenders using a LogFormatter add the stack on the lines after the formatted record, RecordFormatters
+//can use the field as they like. Capturing a stack is much slower than logging a message, so this is off by
+//default, and a level of DEFAULT turns it off again. Stacks are limited to 32 frames, records passed to
+//SubmitRecord don't get a stack.
+func SetStackCaptureLevel(level LogLevel) {
+	atomic.StoreInt32(&stackCaptureLevel, int32(level))
+}
+
+//stackFor returns the stack for a record at the level as text and frames, or an empty string and nil if stacks
+//aren't captured for the level.
+//Skip is the number of logging functions between the caller of stackFor and the code doing the logging.
+func stackFor(level LogLevel, skip int) (string, []runtime.Frame) {
+	capture := LogLevel(atomic.LoadInt32(&stackCaptureLevel))
+
+	if capture == DEFAULT || level < capture {
+		return "", nil
+	}
+
+	pcs := make([]uintptr, maxStackFrames)
+	n := runtime.Callers(skip+3, pcs) //skip runtime.Callers, stackFor and its caller
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack strings.Builder
+	structured := make([]runtime.Frame, 0, n)
+
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&stack, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		structured = append(structured, frame)
+
+		if !more {
+			break
+		}
+	}
+
+	return strings.TrimSuffix(stack.String(), "\n"), structured
+}
+
+//truncatedMarker is added to messages that are cut to the maximum length
+const truncatedMarker = "…[truncated]"
+
+//SetMaxMessageLength limits logged messages to length bytes, longer messages are cut at the last whole
+//character that fits and end with "…[truncated]", which is not counted in the length. The limit is applied
+//after formatting, records passed to SubmitRecord are not changed. A length of 0 or less, the default,
+//doesn't limit messages.
+func SetMaxMessageLength(length int) {
+	atomic.StoreInt64(&maxMessageLength, int64(length))
+}
+
+func truncateMessage(msg string) string {
+	max := int(atomic.LoadInt64(&maxMessageLength))
+
+	if max <= 0 || len(msg) <= max {
+		return msg
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+
+	return msg[:cut] + truncatedMarker
+}
+
+/*
+SetSynchronous switches between the default asynchronous logging, where records are queued and appended by
+the logging go routine, and synchronous logging, where each call appends its record before it returns.
+
+Synchronous logging guarantees that a message is written before the process can exit, and that messages are
+appended in the order the calls finish, which is useful for small command line tools. The cost is that every
+logging call waits for all of the appenders, and logging go routines wait for each other while a record is
+appended, so a slow appender slows down the whole program. Synchronous records are appended even while logging
+is paused or stopped. Replayed records still go through the logging go routine. Records that were queued before
+switching to synchronous mode may be appended after newer synchronous records, call WaitForIncoming first if
+that matters.
+*/
+func SetSynchronous(sync bool) {
+	if sync {
+		atomic.StoreInt32(&synchronous, 1)
 	} else {
-		wait.Add(1)
-		logger.flushBuffer(wait)
+		atomic.StoreInt32(&synchronous, 0)
 	}
+}
+
+//SetBufferFlushHook registers a function that is called each time a logger's buffer is flushed, with the
+//name of the logger and the number of records that were replayed. The hook is called on the go routine
+//doing the flush after the records are queued, flushes of different loggers run concurrently so the hook
+//must be safe for concurrent use. Loggers without a buffer don't call the hook. FlushTagBuffer calls it too,
+//with the tag prefixed by "tag:" in place of the logger name. Pass nil to remove it.
+func SetBufferFlushHook(hook func(loggerName string, count int)) {
+	logMutex.Lock()
+	flushHook = hook
 	logMutex.Unlock()
+}
+
+//FlushBuffer replays the logger's buffered messages without changing its level. The replayed records
+//are checked against the logger's level again, so this is mainly useful with tag levels or paused appenders,
+//records that still don't pass go back in the buffer. Replayed records get Time set to now and keep
+//their Original time. FlushBuffer waits for the records to be queued, not for them to be processed.
+func (logger *LoggerImpl) FlushBuffer() {
+	wait := new(sync.WaitGroup)
+	wait.Add(1)
+
+	logMutex.Lock()
+	logger.flushBuffer(wait)
+	logMutex.Unlock()
+
 	wait.Wait()
 }
 
-//SetBufferLength clears the buffer and creates a new one of the specified length.
-func (logger *LoggerImpl) SetBufferLength(length int) {
-	logMutex.Lock()
+//ReplayBufferTo writes copies of the logger's buffered records directly to the appender, without sending
+//them to the global appenders or clearing the buffer, which makes it useful for inspecting a buffer with
+//something like a MemoryAppender. The records are written before ReplayBufferTo returns, the copies are
+//marked as replayed and get Time set to now. Records that are still queued aren't in the buffer yet,
+//call WaitForIncoming first to include them. The first error from the appender is returned.
+func (logger *LoggerImpl) ReplayBufferTo(appender LogAppender) error {
+	var records []LogRecord
+
+	logMutex.Lock()
+	if logger.buffer != nil {
+		for _, record := range bufferedRecords(logger.buffer) {
+			records = append(records, *record)
+		}
+	}
+	logMutex.Unlock()
+
+	now := timestamp()
+	var firstErr error
+
+	for i := range records {
+		record := &records[i]
+		record.Time = now
+		record.Replayed = true
+
+		if err := appender.Log(record); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+//SetTagBufferLength keeps the last length records with the tag that weren't logged, from every logger, so
+//that they can be written together with FlushTagBuffer, for example when a payment fails. Records are
+//buffered for a tag under the same rules as a logger's buffer. A record can be in its logger's buffer and in
+//tag buffers at the same time, but it is only replayed once, flushing either buffer removes it from the others.
+//Changing the length clears the tag's buffer, a length of 0 or less removes it.
+func SetTagBufferLength(tag string, length int) {
+	logMutex.Lock()
+	if length <= 0 {
+		delete(tagBuffers, tag)
+	} else if buffer, ok := tagBuffers[tag]; !ok || buffer.records.Len() != length {
+		tagBuffers[tag] = &tagBuffer{records: ring.New(length)}
+	}
+	logMutex.Unlock()
+}
+
+//FlushTagBuffer queues the records buffered for the tag for the logging go routine, like FlushBuffer, so they
+//are written after the records that were already queued, use WaitForIncoming to wait for them. Unlike FlushBuffer
+//the records are not checked against the logger levels again, they were buffered because they didn't pass.
+//Replayed records get Time set to now and keep their Original time. While appenders are paused the records
+//stay in the buffer.
+func FlushTagBuffer(tag string) {
+	logMutex.Lock()
+	buffer, ok := tagBuffers[tag]
+
+	if !ok || atomic.LoadInt32(&appendersPaused) == 1 {
+		logMutex.Unlock()
+		return
+	}
+
+	records := bufferedRecords(buffer.records)
+	length := buffer.records.Len()
+	buffer.records = ring.New(length)
+	forgetBuffered(records)
+	hook := flushHook
+	logMutex.Unlock()
+
+	now := timestamp()
+
+	//the lock is released, so the records can be queued from this go routine, ahead of its later records
+	for _, record := range records {
+		record.Time = now
+		record.Replayed = true
+		record.skipLevel = true
+
+		atomic.AddUint64(&logged, 1)
+		sendIncoming(record)
+	}
+
+	countFlush(len(records), length)
+
+	if hook != nil {
+		hook(tagFlushName(tag), len(records))
+	}
+}
+
+//tagFlushName is the name the flush hook gets for a tag buffer
+func tagFlushName(tag string) string {
+	return "tag:" + tag
+}
+
+//bufferedRecords returns the records in a buffer, oldest first, the buffer points at the newest record
+func bufferedRecords(buffer *ring.Ring) []*LogRecord {
+	var records []*LogRecord
+
+	buffer.Next().Do(func(x interface{}) {
+		if x != nil {
+			records = append(records, x.(*LogRecord))
+		}
+	})
+
+	return records
+}
+
+//forgetBuffered removes records that are being replayed from the logger and tag buffers, so that they
+//are only replayed once, it expects the logging lock to be held
+func forgetBuffered(records []*LogRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	replaying := make(map[*LogRecord]bool, len(records))
+	buffers := make(map[*ring.Ring]bool)
+
+	for _, record := range records {
+		replaying[record] = true
+
+		if record.Logger != nil && record.Logger.buffer != nil {
+			buffers[record.Logger.buffer] = true
+		}
+	}
+
+	for _, buffer := range tagBuffers {
+		buffers[buffer.records] = true
+	}
+
+	for buffer := range buffers {
+		for i, r := 0, buffer; i < buffer.Len(); i, r = i+1, r.Next() {
+			if record, ok := r.Value.(*LogRecord); ok && replaying[record] {
+				r.Value = nil
+			}
+		}
+	}
+}
+
+//bufferTagged adds a record that wasn't logged to the buffers for its tags, it expects to be
+//called by the logging go routine with the read lock held
+func bufferTagged(record *LogRecord) {
+	if len(tagBuffers) == 0 {
+		return
+	}
+
+	for _, tag := range record.Tags {
+		buffer, ok := tagBuffers[tag]
+
+		if ok && buffer.records.Value != record {
+			buffer.records.Next().Value = record
+			buffer.records = buffer.records.Next()
+		}
+	}
+}
+
+//Clone creates a new logger with the same name, level and tag levels as this one, and an empty
+//buffer of the same length. Clones are not registered with GetLogger, so changing a clone doesn't
+//affect the named logger and changing the named logger doesn't affect its clones.
+func (logger *LoggerImpl) Clone() Logger {
+	logMutex.RLock()
+	defer logMutex.RUnlock()
 
-	logger.setBufferLengthImpl(length)
+	clone := new(LoggerImpl)
+	clone.name = logger.name
+	clone.level = logger.level
 
-	logMutex.Unlock()
+	if logger.tagLevels != nil {
+		clone.tagLevels = make(map[string]LogLevel, len(logger.tagLevels))
+		for tag, level := range logger.tagLevels {
+			clone.tagLevels[tag] = level
+		}
+	}
+
+	clone.setBufferLengthImpl(logger.buffer.Len())
+	return clone
 }
 
 //expects the lock
 func (logger *LoggerImpl) setBufferLengthImpl(length int) {
 
+	if length < 0 {
+		logError(fmt.Errorf("buffer length %d for logger %s is negative, the buffer is removed", length, logger.name))
+		length = 0
+	}
+
+	if length != logger.buffer.Len() && logger.buffer != nil {
+		atomic.AddUint64(&suppressedRecords, uint64(len(bufferedRecords(logger.buffer))))
+	}
+
 	if length == 0 {
 		logger.buffer = nil
 	} else if length != logger.buffer.Len() {
@@ -367,6 +1344,12 @@ func (logger *LoggerImpl) setBufferLengthImpl(length int) {
 	}
 }
 
+//timestamp returns the current time without its monotonic clock reading, so that record times
+//compare and serialize the same way before and after they are buffered
+func timestamp() time.Time {
+	return time.Now().Round(0)
+}
+
 //NewLogRecord creates a log record object
 func NewLogRecord(logger *LoggerImpl, level LogLevel, tags []string, message string, time time.Time, original time.Time) *LogRecord {
 	record := new(LogRecord)
@@ -379,17 +1362,85 @@ func NewLogRecord(logger *LoggerImpl, level LogLevel, tags []string, message str
 	return record
 }
 
+//SubmitRecord enqueues a fully formed record so that it is processed as if it had been logged locally.
+//The level of the record's logger, or the default logger if the record has none, is used to filter and
+//buffer the record. A zero Time is set to now and a zero Original is set to Time. The record is given a
+//new sequence number.
+func SubmitRecord(record *LogRecord) {
+	if record == nil {
+		return
+	}
+
+	if record.Logger == nil {
+		record.Logger = defaultLogger
+	}
+
+	if record.Time.IsZero() {
+		record.Time = timestamp()
+	}
+
+	if record.Original.IsZero() {
+		record.Original = record.Time
+	}
+
+	enqueue(record)
+}
+
+//reportAppenderError reports an error from an appender's own go routine, outside the processing of a record
+func reportAppenderError(appender LogAppender, err error) {
+	logMutex.RLock()
+	logEvent(LoggingEvent{Err: err, Appender: appender})
+	logMutex.RUnlock()
+}
+
 //should be called inside the logging lock,
-//puts the error on the logging error channel if one is set
+//reports an error that isn't associated with an appender
 func logError(err error) {
-	if err != nil && logErrors != nil {
+	logEvent(LoggingEvent{Err: err})
+}
 
-		select {
-		case logErrors <- err:
-			//write the error
-		default:
-			//don't write or block
-		}
+//should be called inside the logging lock,
+//puts the event on the logging event channel and its error on the logging error channel,
+//if they are set
+func logEvent(event LoggingEvent) {
+	if event.Err == nil {
+		return
+	}
+
+	if reporter := testModeTB(); reporter != nil {
+		reporter.Errorf("logging error: %v", event.Err)
+	}
+
+	if logEvents != nil {
+		sendEvent(logEvents, event)
+	}
+
+	if logErrors != nil {
+		sendError(logErrors, event.Err)
+	}
+}
+
+//sendEvent doesn't block, and recovers if the user closed the channel without unregistering it
+func sendEvent(events chan<- LoggingEvent, event LoggingEvent) {
+	defer func() { recover() }()
+
+	select {
+	case events <- event:
+		//write the event
+	default:
+		//don't write or block
+	}
+}
+
+//sendError doesn't block, and recovers if the user closed the channel without unregistering it
+func sendError(errs chan<- error, err error) {
+	defer func() { recover() }()
+
+	select {
+	case errs <- err:
+		//write the error
+	default:
+		//don't write or block
 	}
 }
 
@@ -429,9 +1480,71 @@ func (logger *LoggerImpl) CheckLevel(l LogLevel, tags []string) bool {
 	return logger.checkLevelWithTags(l, tags)
 }
 
+//WouldLog tests the default logger and the appenders for their permissions
+func WouldLog(l LogLevel, tags []string) bool {
+	return defaultLogger.WouldLog(l, tags)
+}
+
+//WouldLog checks the level like CheckLevel, and also requires that at least one appender
+//would accept a record at that level, so it is the end to end version of CheckLevel. Appenders
+//without a CheckLevel method are assumed to accept every level. The levels the appenders accept
+//are cached, the cache is cleared when appenders are added or removed, or when the level or enabled
+//state of an appender built on BaseLogAppender changes. Appenders with their own CheckLevel should
+//call AppenderLevelsChanged when the levels they accept change.
+func (logger *LoggerImpl) WouldLog(l LogLevel, tags []string) bool {
+
+	logMutex.RLock()
+	defer logMutex.RUnlock()
+
+	return logger.checkLevelWithTags(l, tags) && appendersAccept(l)
+}
+
+//AppenderLevelsChanged clears the cached appender levels used by WouldLog, appenders that implement
+//their own CheckLevel, instead of using BaseLogAppender's level, call it when their level changes
+func AppenderLevelsChanged() {
+	atomic.AddUint64(&appenderGeneration, 1)
+}
+
+type acceptedLevels struct {
+	generation uint64
+	accepts    [256]bool
+}
+
+func appendersAccept(l LogLevel) bool {
+	generation := atomic.LoadUint64(&appenderGeneration)
+	cached, ok := appenderLevels.Load().(*acceptedLevels)
+
+	if !ok || cached.generation != generation {
+		cached = &acceptedLevels{generation: generation}
+
+		for _, appender := range currentAppenders() {
+			if !appenderEnabled(appender) {
+				continue
+			}
+
+			checker, ok := appender.(levelChecker)
+
+			for level := range cached.accepts {
+				if !ok || checker.CheckLevel(LogLevel(level)) {
+					cached.accepts[level] = true
+				}
+			}
+		}
+
+		//if the generation changed while building, the next check will build it again
+		appenderLevels.Store(cached)
+	}
+
+	return cached.accepts[l]
+}
+
 //requires the lock be acquired
 func (logger *LoggerImpl) checkLevelWithTags(l LogLevel, tags []string) bool {
 
+	if isMuted(tags) || !logger.Enabled() {
+		return false
+	}
+
 	if (logger.tagLevels != nil || defaultLogger.tagLevels != nil) && tags != nil {
 		matchTag := logger.checkTagLevel(l, tags)
 		if matchTag {
@@ -439,11 +1552,26 @@ func (logger *LoggerImpl) checkLevelWithTags(l LogLevel, tags []string) bool {
 		}
 	}
 
-	if logger.level != DEFAULT {
-		return logger.level <= l
+	return logger.effectiveLevel() <= l
+}
+
+//requires the lock be acquired, returns the level from the level source or the logger,
+//falling back to the default logger
+func (logger *LoggerImpl) effectiveLevel() LogLevel {
+
+	if level, ok := levelFromSource(logger.name); ok {
+		return level
+	}
+
+	if logger.level != DEFAULT || logger == defaultLogger {
+		return logger.level
+	}
+
+	if level, ok := levelFromSource(defaultLogger.name); ok {
+		return level
 	}
 
-	return defaultLogger.level <= l
+	return defaultLogger.level
 }
 
 //flushAllLoggers expects the logging lock to be held by the caller
@@ -455,40 +1583,206 @@ func flushAllLoggers(wait *sync.WaitGroup) {
 	defaultLogger.flushBuffer(wait)
 }
 
-//should be called witin the lock
-func logToAppenders(record *LogRecord) {
-	for _, appender := range appenders {
+//should be called witin the lock, so that appenders aren't closed while they are in use
+//the errors from the appenders are reported and returned together
+func logToAppenders(record *LogRecord) error {
+	var failures []error
+
+	for _, appender := range currentAppenders() {
+		if !appenderEnabled(appender) {
+			continue
+		}
+
 		err := appender.Log(record)
-		logError(err)
+		logEvent(LoggingEvent{Err: err, Record: record, Appender: appender})
+
+		if err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	return combineFailures(failures)
+}
+
+//logBatchToAppenders writes the records to every appender, BatchAppenders get them in one call, and returns
+//the error for each record, or nil if nothing failed. An error from LogBatch is reported once, without a record.
+func logBatchToAppenders(records []*LogRecord) []error {
+	var failures [][]error
+
+	for _, appender := range currentAppenders() {
+		if !appenderEnabled(appender) {
+			continue
+		}
+
+		if batcher, ok := appender.(BatchAppender); ok {
+			//records is scratch space that is reused for the next batch, the appender may keep its copy
+			err := batcher.LogBatch(append([]*LogRecord(nil), records...))
+			logEvent(LoggingEvent{Err: err, Appender: appender})
+
+			if err != nil {
+				if failures == nil {
+					failures = make([][]error, len(records))
+				}
+				for i := range records {
+					failures[i] = append(failures[i], err)
+				}
+			}
+			continue
+		}
+
+		for i, record := range records {
+			err := appender.Log(record)
+			logEvent(LoggingEvent{Err: err, Record: record, Appender: appender})
+
+			if err != nil {
+				if failures == nil {
+					failures = make([][]error, len(records))
+				}
+				failures[i] = append(failures[i], err)
+			}
+		}
+	}
+
+	if failures == nil {
+		return nil
+	}
+
+	errs := make([]error, len(records))
+	for i, failed := range failures {
+		errs[i] = combineFailures(failed)
+	}
+	return errs
+}
+
+//combineFailures returns nil, the only error, or an error listing all of the appender errors
+func combineFailures(failures []error) error {
+	switch len(failures) {
+	case 0:
+		return nil
+	case 1:
+		return failures[0]
+	default:
+		messages := make([]string, len(failures))
+		for i, err := range failures {
+			messages[i] = err.Error()
+		}
+		return fmt.Errorf("%d appenders failed: %s", len(failures), strings.Join(messages, "; "))
+	}
+}
+
+//confirmRecord sends the outcome for a record logged with LogAndConfirm, only the first outcome is sent
+func confirmRecord(record *LogRecord, err error) {
+	if record.confirm != nil {
+		record.confirm <- err
+		record.confirm = nil
 	}
 }
 
 func processLogRecord(record *LogRecord) {
+	if record == nil {
+		return
+	}
+
 	logMutex.RLock()
 	defer logMutex.RUnlock()
 
 	logger := record.Logger
-	passed := logger.checkLevelWithTags(record.Level, record.Tags)
+	passed := record.skipLevel || logger.checkLevelWithTags(record.Level, record.Tags)
 
-	if passed {
-		logToAppenders(record)
-	} else if logger.buffer != nil && record.Level > VERBOSE {
-		logger.buffer.Next().Value = record
-		logger.buffer = logger.buffer.Next()
+	if passed && atomic.LoadInt32(&appendersPaused) != 1 {
+		confirmRecord(record, logToAppenders(record))
+	} else {
+		bufferRecord(record)
 	}
 	atomic.AddUint64(&processed, 1)
 }
 
+//processLogRecords processes records taken from the channel together, the records that pass
+//their levels are written to the appenders as a batch
+func processLogRecords(records []*LogRecord) {
+	if len(records) == 1 {
+		processLogRecord(records[0])
+		return
+	}
+
+	logMutex.RLock()
+	defer logMutex.RUnlock()
+
+	passed := passedScratch[:0]
+	paused := atomic.LoadInt32(&appendersPaused) == 1
+
+	for _, record := range records {
+		if record == nil {
+			continue
+		}
+
+		if !paused && (record.skipLevel || record.Logger.checkLevelWithTags(record.Level, record.Tags)) {
+			passed = append(passed, record)
+			continue
+		}
+
+		bufferRecord(record)
+		atomic.AddUint64(&processed, 1)
+	}
+
+	if len(passed) == 0 {
+		return
+	}
+
+	errs := logBatchToAppenders(passed)
+
+	for i, record := range passed {
+		var err error
+		if errs != nil {
+			err = errs[i]
+		}
+		confirmRecord(record, err)
+		passed[i] = nil
+	}
+	atomic.AddUint64(&processed, uint64(len(passed)))
+	passedScratch = passed
+}
+
+//passedScratch is reused by processLogRecords for the records that passed, it is protected by the process mutex
+var passedScratch []*LogRecord
+
+//bufferRecord expects the read lock, it confirms a record that wasn't logged and keeps it in the buffers
+func bufferRecord(record *LogRecord) {
+	record.skipLevel = false
+
+	if record.confirm != nil {
+		confirmRecord(record, fmt.Errorf("%v record was not logged, it didn't pass the level or appenders are paused", record.Level))
+	}
+
+	if record.Level > VERBOSE && !isMuted(record.Tags) && record.Logger.Enabled() {
+		if record.Logger.buffer != nil {
+			if record.Logger.buffer.Next().Value != nil {
+				atomic.AddUint64(&suppressedRecords, 1) //overwritten without being logged
+			}
+			record.Logger.buffer.Next().Value = record
+			record.Logger.buffer = record.Logger.buffer.Next()
+		}
+		bufferTagged(record)
+	}
+}
+
 //flushBuffer expects the logging lock to be held, and does not take the lock
 //should call done on the wait group when the buffer is flushed
 //does not 1 to the waitgroup
 func (logger *LoggerImpl) flushBuffer(wait *sync.WaitGroup) {
 	if logger.buffer != nil {
-		now := time.Now()
+		now := timestamp()
 		oldBuffer := logger.buffer
 		logger.buffer = ring.New(oldBuffer.Len())
+		hook := flushHook
+
+		if len(tagBuffers) > 0 {
+			forgetBuffered(bufferedRecords(oldBuffer))
+		}
 
 		go func() {
+			count := 0
+
 			oldBuffer.Do(func(x interface{}) {
 
 				if x == nil {
@@ -497,11 +1791,19 @@ func (logger *LoggerImpl) flushBuffer(wait *sync.WaitGroup) {
 
 				record := x.(*LogRecord)
 				record.Time = now
+				record.Replayed = true
 
 				atomic.AddUint64(&logged, 1)
-				incomingChannel <- record
+				sendIncoming(record)
+				count++
 			})
 
+			countFlush(count, oldBuffer.Len())
+
+			if hook != nil {
+				hook(logger.name, count)
+			}
+
 			wait.Done()
 		}()
 	} else {
@@ -509,13 +1811,55 @@ func (logger *LoggerImpl) flushBuffer(wait *sync.WaitGroup) {
 	}
 }
 
+//enqueue assigns the record its sequence number and pushes it to the logging go routine,
+//or processes it on the calling go routine in synchronous mode
+func enqueue(record *LogRecord) {
+	record.Seq = atomic.AddUint64(&logged, 1)
+
+	if atomic.LoadInt32(&synchronous) == 1 {
+		processMutex.Lock()
+		processLogRecord(record)
+		processMutex.Unlock()
+		return
+	}
+
+	sendIncoming(record)
+}
+
+//sendIncoming queues the record for the logging go routine, unless StopAndDrain has been called,
+//sending counts the records between checking for the drain and queueing them
+func sendIncoming(record *LogRecord) {
+	atomic.AddInt32(&sending, 1)
+
+	if atomic.LoadInt32(&draining) == 0 {
+		incomingChannel <- record
+	} else {
+		atomic.AddUint64(&processed, 1) //discarded, so WaitForIncoming doesn't wait for it
+	}
+
+	atomic.AddInt32(&sending, -1)
+}
+
+//logMessage creates a record for an already formatted message and enqueues it
+func (logger *LoggerImpl) logMessage(level LogLevel, tags []string, msg string) {
+
+	if shouldShed(level) {
+		atomic.AddUint64(&dropped, 1)
+		return
+	}
+
+	now := timestamp()
+	record := NewLogRecord(logger, level, recordTags(tags), truncateMessage(msg), now, now)
+	record.Stack, record.Frames = stackFor(level, 2)
+	enqueue(record)
+}
+
 func (logger *LoggerImpl) logwithformat(level LogLevel, tags []string, format string, args ...interface{}) {
 
-	if level == VERBOSE && atomic.LoadInt32(&enableVerbose) != 1 {
+	if (level == VERBOSE && atomic.LoadInt32(&enableVerbose) != 1) || !logger.Enabled() {
 		return
 	}
 
-	now := time.Now()
 	msg := ""
 
 	if format == "" {
@@ -524,13 +1868,47 @@ func (logger *LoggerImpl) logwithformat(level LogLevel, tags []string, format st
 		msg = fmt.Sprintf(format, args...)
 	}
 
-	logRecord := NewLogRecord(logger, level, tags, msg, now, now)
-	atomic.AddUint64(&logged, 1)
-	incomingChannel <- logRecord
+	logger.logMessage(level, tags, msg)
 }
 
 func (logger *LoggerImpl) log(level LogLevel, tags []string, args ...interface{}) {
-	logger.logwithformat(level, tags, "", args...)
+
+	if (level == VERBOSE && atomic.LoadInt32(&enableVerbose) != 1) || !logger.Enabled() {
+		return
+	}
+
+	logger.logMessage(level, tags, fmt.Sprint(args...))
+}
+
+//logln joins the arguments like fmt.Sprintln, always adding spaces, without the trailing new line
+func (logger *LoggerImpl) logln(level LogLevel, tags []string, args ...interface{}) {
+
+	if (level == VERBOSE && atomic.LoadInt32(&enableVerbose) != 1) || !logger.Enabled() {
+		return
+	}
+
+	msg := fmt.Sprintln(args...)
+	logger.logMessage(level, tags, msg[:len(msg)-1])
+}
+
+//logKV builds "msg key=val" without fmt or boxing the value, for hot paths
+func (logger *LoggerImpl) logKV(level LogLevel, msg string, key string, val int64) {
+	if !logger.Enabled() {
+		return
+	}
+
+	var digits [20]byte
+	number := strconv.AppendInt(digits[:0], val, 10)
+
+	var builder strings.Builder
+	builder.Grow(len(msg) + len(key) + len(number) + 2)
+	builder.WriteString(msg)
+	builder.WriteByte(' ')
+	builder.WriteString(key)
+	builder.WriteByte('=')
+	builder.Write(number)
+
+	logger.logMessage(level, nil, builder.String())
 }
 
 //ErrorWithTagsf logs an ERROR level message with the provided tags and formatted string.
@@ -553,6 +1931,16 @@ func (logger *LoggerImpl) Error(args ...interface{}) {
 	logger.log(ERROR, nil, args...)
 }
 
+//Errorln logs an ERROR level message with no tags and provided arguments joined into a string with spaces between them.
+func (logger *LoggerImpl) Errorln(args ...interface{}) {
+	logger.logln(ERROR, nil, args...)
+}
+
+//ErrorKV logs an ERROR level message with no tags, made of the message and a key=value pair, without using fmt.
+func (logger *LoggerImpl) ErrorKV(msg string, key string, val int64) {
+	logger.logKV(ERROR, msg, key, val)
+}
+
 //WarnWithTagsf logs an WARN level message with the provided tags and formatted string.
 func (logger *LoggerImpl) WarnWithTagsf(tags []string, fmt string, args ...interface{}) {
 	logger.logwithformat(WARN, tags, fmt, args...)
@@ -573,6 +1961,16 @@ func (logger *LoggerImpl) Warn(args ...interface{}) {
 	logger.log(WARN, nil, args...)
 }
 
+//Warnln logs an WARN level message with no tags and provided arguments joined into a string with spaces between them.
+func (logger *LoggerImpl) Warnln(args ...interface{}) {
+	logger.logln(WARN, nil, args...)
+}
+
+//WarnKV logs an WARN level message with no tags, made of the message and a key=value pair, without using fmt.
+func (logger *LoggerImpl) WarnKV(msg string, key string, val int64) {
+	logger.logKV(WARN, msg, key, val)
+}
+
 //InfoWithTagsf logs an INFO level message with the provided tags and formatted string.
 func (logger *LoggerImpl) InfoWithTagsf(tags []string, fmt string, args ...interface{}) {
 	logger.logwithformat(INFO, tags, fmt, args...)
@@ -593,6 +1991,16 @@ func (logger *LoggerImpl) Info(args ...interface{}) {
 	logger.log(INFO, nil, args...)
 }
 
+//Infoln logs an INFO level message with no tags and provided arguments joined into a string with spaces between them.
+func (logger *LoggerImpl) Infoln(args ...interface{}) {
+	logger.logln(INFO, nil, args...)
+}
+
+//InfoKV logs an INFO level message with no tags, made of the message and a key=value pair, without using fmt.
+func (logger *LoggerImpl) InfoKV(msg string, key string, val int64) {
+	logger.logKV(INFO, msg, key, val)
+}
+
 //DebugWithTagsf logs an DEBUG level message with the provided tags and formatted string.
 func (logger *LoggerImpl) DebugWithTagsf(tags []string, fmt string, args ...interface{}) {
 	logger.logwithformat(DEBUG, tags, fmt, args...)
@@ -613,6 +2021,16 @@ func (logger *LoggerImpl) Debug(args ...interface{}) {
 	logger.log(DEBUG, nil, args...)
 }
 
+//Debugln logs an DEBUG level message with no tags and provided arguments joined into a string with spaces between them.
+func (logger *LoggerImpl) Debugln(args ...interface{}) {
+	logger.logln(DEBUG, nil, args...)
+}
+
+//DebugKV logs an DEBUG level message with no tags, made of the message and a key=value pair, without using fmt.
+func (logger *LoggerImpl) DebugKV(msg string, key string, val int64) {
+	logger.logKV(DEBUG, msg, key, val)
+}
+
 //VerboseWithTagsf logs an VERBOSE level message with the provided tags and formatted string.
 //Verbose messages are not buffered
 func (logger *LoggerImpl) VerboseWithTagsf(tags []string, fmt string, args ...interface{}) {
@@ -625,6 +2043,73 @@ func (logger *LoggerImpl) Verbosef(fmt string, args ...interface{}) {
 	logger.logwithformat(VERBOSE, nil, fmt, args...)
 }
 
+//LogWithTagsf logs a message at the provided level, which can be a custom level, with the provided tags and formatted string.
+func (logger *LoggerImpl) LogWithTagsf(l LogLevel, tags []string, fmt string, args ...interface{}) {
+	logger.logwithformat(l, tags, fmt, args...)
+}
+
+//LogWithTags logs a message at the provided level, which can be a custom level, with the provided tags and provided arguments joined into a string.
+func (logger *LoggerImpl) LogWithTags(l LogLevel, tags []string, args ...interface{}) {
+	logger.log(l, tags, args...)
+}
+
+//LogAndConfirm logs a message at the provided level with the provided tags, and returns a channel that receives
+//the outcome once every appender has been given the record. The outcome is nil if every appender accepted it,
+//appenders that skip the record because of their own level count as accepting it. Otherwise it holds the
+//appenders' errors, or an error saying the record wasn't logged because it didn't pass the logger's level,
+//appenders were paused or the record was shed. A record that wasn't logged can still be buffered and replayed
+//later, but the outcome is only sent once. This is meant for the rare record, like an audit entry, that the
+//caller must know was written, waiting on the channel while logging is paused will block.
+func (logger *LoggerImpl) LogAndConfirm(l LogLevel, tags []string, msg string) <-chan error {
+	return logger.logAndConfirm(l, tags, msg)
+}
+
+func (logger *LoggerImpl) logAndConfirm(l LogLevel, tags []string, msg string) <-chan error {
+	confirm := make(chan error, 1)
+
+	if !logger.Enabled() {
+		confirm <- fmt.Errorf("%v record was not logged, the logger %s is disabled", l, logger.name)
+		return confirm
+	}
+
+	if shouldShed(l) {
+		atomic.AddUint64(&dropped, 1)
+		confirm <- fmt.Errorf("%v record was not logged, it was shed because the queue is full", l)
+		return confirm
+	}
+
+	now := timestamp()
+	record := NewLogRecord(logger, l, recordTags(tags), truncateMessage(msg), now, now)
+	record.Stack, record.Frames = stackFor(l, 1)
+	record.confirm = confirm
+	enqueue(record)
+
+	return confirm
+}
+
+//LogAt logs a message with a time from the caller instead of now, for importing or re-logging historical
+//events. The record's Time and Original are both set to the time, it is otherwise logged like LogWithTags.
+func (logger *LoggerImpl) LogAt(when time.Time, l LogLevel, tags []string, msg string) {
+	logger.logAt(when, l, tags, msg)
+}
+
+func (logger *LoggerImpl) logAt(when time.Time, l LogLevel, tags []string, msg string) {
+
+	if (l == VERBOSE && atomic.LoadInt32(&enableVerbose) != 1) || !logger.Enabled() {
+		return
+	}
+
+	if shouldShed(l) {
+		atomic.AddUint64(&dropped, 1)
+		return
+	}
+
+	when = when.Round(0) //like timestamp, drop the monotonic clock reading
+	record := NewLogRecord(logger, l, recordTags(tags), truncateMessage(msg), when, when)
+	record.Stack, record.Frames = stackFor(l, 1)
+	enqueue(record)
+}
+
 //ErrorWithTagsf logs an ERROR level message with the provided tags and formatted string. Uses the default logger.
 func ErrorWithTagsf(tags []string, fmt string, args ...interface{}) {
 	defaultLogger.logwithformat(ERROR, tags, fmt, args...)
@@ -645,6 +2130,16 @@ func Error(args ...interface{}) {
 	defaultLogger.log(ERROR, nil, args...)
 }
 
+//Errorln logs an ERROR level message with no tags and provided arguments joined into a string with spaces between them. Uses the default logger.
+func Errorln(args ...interface{}) {
+	defaultLogger.logln(ERROR, nil, args...)
+}
+
+//ErrorKV logs an ERROR level message with no tags, made of the message and a key=value pair, without using fmt. Uses the default logger.
+func ErrorKV(msg string, key string, val int64) {
+	defaultLogger.logKV(ERROR, msg, key, val)
+}
+
 //WarnWithTagsf logs an WARN level message with the provided tags and formatted string. Uses the default logger.
 func WarnWithTagsf(tags []string, fmt string, args ...interface{}) {
 	defaultLogger.logwithformat(WARN, tags, fmt, args...)
@@ -665,6 +2160,16 @@ func Warn(args ...interface{}) {
 	defaultLogger.log(WARN, nil, args...)
 }
 
+//Warnln logs an WARN level message with no tags and provided arguments joined into a string with spaces between them. Uses the default logger.
+func Warnln(args ...interface{}) {
+	defaultLogger.logln(WARN, nil, args...)
+}
+
+//WarnKV logs an WARN level message with no tags, made of the message and a key=value pair, without using fmt. Uses the default logger.
+func WarnKV(msg string, key string, val int64) {
+	defaultLogger.logKV(WARN, msg, key, val)
+}
+
 //InfoWithTagsf logs an INFO level message with the provided tags and formatted string. Uses the default logger.
 func InfoWithTagsf(tags []string, fmt string, args ...interface{}) {
 	defaultLogger.logwithformat(INFO, tags, fmt, args...)
@@ -685,6 +2190,16 @@ func Info(args ...interface{}) {
 	defaultLogger.log(INFO, nil, args...)
 }
 
+//Infoln logs an INFO level message with no tags and provided arguments joined into a string with spaces between them. Uses the default logger.
+func Infoln(args ...interface{}) {
+	defaultLogger.logln(INFO, nil, args...)
+}
+
+//InfoKV logs an INFO level message with no tags, made of the message and a key=value pair, without using fmt. Uses the default logger.
+func InfoKV(msg string, key string, val int64) {
+	defaultLogger.logKV(INFO, msg, key, val)
+}
+
 //DebugWithTagsf logs an DEBUG level message with the provided tags and formatted string. Uses the default logger.
 func DebugWithTagsf(tags []string, fmt string, args ...interface{}) {
 	defaultLogger.logwithformat(DEBUG, tags, fmt, args...)
@@ -705,6 +2220,16 @@ func Debug(args ...interface{}) {
 	defaultLogger.log(DEBUG, nil, args...)
 }
 
+//Debugln logs an DEBUG level message with no tags and provided arguments joined into a string with spaces between them. Uses the default logger.
+func Debugln(args ...interface{}) {
+	defaultLogger.logln(DEBUG, nil, args...)
+}
+
+//DebugKV logs an DEBUG level message with no tags, made of the message and a key=value pair, without using fmt. Uses the default logger.
+func DebugKV(msg string, key string, val int64) {
+	defaultLogger.logKV(DEBUG, msg, key, val)
+}
+
 //VerboseWithTagsf logs an VERBOSE level message with the provided tags and formatted string. Uses the default logger.
 //Verbose messages are not buffered
 func VerboseWithTagsf(tags []string, fmt string, args ...interface{}) {
@@ -716,3 +2241,23 @@ func VerboseWithTagsf(tags []string, fmt string, args ...interface{}) {
 func Verbosef(fmt string, args ...interface{}) {
 	defaultLogger.logwithformat(VERBOSE, nil, fmt, args...)
 }
+
+//LogWithTagsf logs a message at the provided level, which can be a custom level, with the provided tags and formatted string. Uses the default logger.
+func LogWithTagsf(l LogLevel, tags []string, fmt string, args ...interface{}) {
+	defaultLogger.logwithformat(l, tags, fmt, args...)
+}
+
+//LogWithTags logs a message at the provided level, which can be a custom level, with the provided tags and provided arguments joined into a string. Uses the default logger.
+func LogWithTags(l LogLevel, tags []string, args ...interface{}) {
+	defaultLogger.log(l, tags, args...)
+}
+
+//LogAndConfirm logs a message and returns a channel that receives the outcome, see LoggerImpl.LogAndConfirm. Uses the default logger.
+func LogAndConfirm(l LogLevel, tags []string, msg string) <-chan error {
+	return defaultLogger.logAndConfirm(l, tags, msg)
+}
+
+//LogAt logs a message with a time from the caller, see LoggerImpl.LogAt. Uses the default logger.
+func LogAt(when time.Time, l LogLevel, tags []string, msg string) {
+	defaultLogger.logAt(when, l, tags, msg)
+}
@@ -3,9 +3,12 @@ package logging
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"math/rand"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,6 +29,71 @@ func setup() (Logger, *MemoryAppender) {
 	return logger, memoryAppender
 }
 
+//restartAfterStop resets the state StopLogging and StopAndDrain leave behind and starts a new logging
+//go routine, so tests that stop logging don't break the tests after them
+func restartAfterStop() {
+	atomic.StoreInt32(&draining, 0)
+	atomic.StoreInt32(&loggingPaused, 0)
+	pauseMutex.Lock()
+	loggingStopped = false
+	pauseMutex.Unlock()
+	waiter.Add(1)
+	go processIncoming()
+}
+
+//setupImpl is setup for tests that use the methods that are only on LoggerImpl
+func setupImpl() (*LoggerImpl, *MemoryAppender) {
+	logger, memoryAppender := setup()
+	return logger.(*LoggerImpl), memoryAppender
+}
+
+//recordAppender keeps the records it is asked to log so tests can inspect them
+type recordAppender struct {
+	BaseLogAppender
+	records []*LogRecord
+}
+
+func (appender *recordAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+	appender.records = append(appender.records, record)
+	return nil
+}
+
+func (appender *recordAppender) getRecords() []*LogRecord {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+	return appender.records
+}
+
+//batchAppender keeps the size of each batch it is given
+type batchAppender struct {
+	recordAppender
+	batches []int
+	kept    [][]*LogRecord
+}
+
+func (appender *batchAppender) LogBatch(records []*LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+	appender.records = append(appender.records, records...)
+	appender.batches = append(appender.batches, len(records))
+	appender.kept = append(appender.kept, records)
+	return nil
+}
+
+func (appender *batchAppender) getKept() [][]*LogRecord {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+	return appender.kept
+}
+
+func (appender *batchAppender) getBatches() []int {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+	return appender.batches
+}
+
 func TestNamedLoggers(t *testing.T) {
 	logger := GetLogger("named-logger")
 	logger2 := GetLogger("named-logger")
@@ -38,6 +106,57 @@ func TestNamedLoggers(t *testing.T) {
 	assert.False(t, logger == logger2, "named loggers should change when cleared")
 }
 
+func TestDisableLogger(t *testing.T) {
+	logger, memory := setupImpl()
+	logger.SetBufferLength(5)
+	logger.SetLogLevel(ERROR)
+
+	logger.Disable()
+	assert.False(t, logger.Enabled(), "the logger should be disabled")
+	assert.False(t, logger.CheckLevel(ERROR, nil), "a disabled logger doesn't pass any level")
+
+	logger.Error("error")
+	logger.Infof("info %d", 1)
+	WaitForIncoming()
+	assert.NotNil(t, <-logger.LogAndConfirm(ERROR, nil, "confirmed"), "confirmed records should fail")
+
+	logger.Enable()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "nothing should be logged or buffered while disabled")
+	assert.Equal(t, logger.Level(), INFO, "the level is kept")
+
+	logger.Info("enabled")
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"enabled"}, "an enabled logger uses its level")
+}
+
+func TestCloneLogger(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(WARN)
+	logger.SetTagLevel("tag", DEBUG)
+	logger.SetBufferLength(5)
+
+	clone := logger.Clone()
+	clone.SetLogLevel(DEBUG)
+	clone.SetTagLevel("tag", ERROR)
+
+	assert.False(t, logger.CheckLevel(INFO, nil), "changing the clone's level shouldn't change the original")
+	assert.True(t, logger.CheckLevel(DEBUG, []string{"tag"}), "changing the clone's tag level shouldn't change the original")
+	assert.True(t, clone.CheckLevel(INFO, nil), "the clone should use its own level")
+
+	impl := logger.(*LoggerImpl)
+	cloneImpl := clone.(*LoggerImpl)
+	assert.Equal(t, cloneImpl.name, impl.name, "the clone should have the same name")
+	assert.Equal(t, cloneImpl.buffer.Len(), 5, "the clone should have a buffer of the same length")
+	assert.False(t, cloneImpl.buffer == impl.buffer, "the clone should have its own buffer")
+	assert.True(t, GetLogger(impl.name) == logger, "the clone should not replace the named logger")
+
+	clone.Info("info")
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 1, "the clone should log through the shared appenders")
+}
+
 func TestAddTag(t *testing.T) {
 	t.Parallel()
 
@@ -243,6 +362,53 @@ func TestFormatMethods(t *testing.T) {
 	assert.Equal(t, memory.GetLoggedMessages()[7], "one 1", "messages should be formatted")
 }
 
+func TestLnMethods(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(DEBUG)
+
+	logger.Error("one", "two")
+	logger.Errorln("one", "two")
+	logger.Warnln("one", 1)
+	logger.Infoln("one", "two")
+	logger.Debugln("one", "two")
+	logger.Debugln()
+
+	WaitForIncoming()
+	SetDefaultLogLevel(DEBUG)
+
+	Errorln("one", "two")
+	Warnln("one", "two")
+	Infoln("one", "two")
+	Debugln("one", "two")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages()[0], "onetwo", "plain methods don't add spaces between strings")
+	assert.Equal(t, memory.GetLoggedMessages()[1], "one two", "ln methods always add spaces")
+	assert.Equal(t, memory.GetLoggedMessages()[2], "one 1", "ln methods always add spaces")
+	assert.Equal(t, memory.GetLoggedMessages()[3], "one two", "ln methods always add spaces")
+	assert.Equal(t, memory.GetLoggedMessages()[4], "one two", "ln methods always add spaces")
+	assert.Equal(t, memory.GetLoggedMessages()[5], "", "ln methods trim the new line")
+	assert.Equal(t, memory.GetLoggedMessages()[6:], []string{"one two", "one two", "one two", "one two"}, "ln methods work on the default logger")
+}
+
+func TestKVMethods(t *testing.T) {
+	logger, memory := setupImpl()
+	logger.SetLogLevel(DEBUG)
+	SetDefaultLogLevel(DEBUG)
+
+	logger.ErrorKV("one", "a", 1)
+	logger.WarnKV("two", "b", -2)
+	logger.InfoKV("three", "c", 3)
+	logger.DebugKV("four", "d", 4)
+	ErrorKV("five", "e", 5)
+	WarnKV("six", "f", 6)
+	InfoKV("seven", "g", 7)
+	DebugKV("eight", "h", 8)
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"one a=1", "two b=-2", "three c=3", "four d=4", "five e=5", "six f=6", "seven g=7", "eight h=8"}, "KV methods add key=value to the message")
+}
+
 func TestFormatMethodsWithTags(t *testing.T) {
 	logger, memory := setup()
 	memory.SetFormatter(GetFormatter(MINIMALTAGGED))
@@ -464,6 +630,15 @@ func TestConfigWhileStoppedLogging(t *testing.T) {
 	assert.Equal(t, len(memory2.GetLoggedMessages()), 1, "Only new messages should be in the new log.")
 }
 
+func TestProcessNilRecord(t *testing.T) {
+	_, memory := setup()
+
+	processLogRecord(nil)
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "nil records should be ignored")
+}
+
 func TestErrorChannel(t *testing.T) {
 
 	errors := make(chan error, 10)
@@ -521,3 +696,990 @@ func TestErrorChannelWontBlock(t *testing.T) {
 	WaitForIncoming()
 	assert.Equal(t, errorApp.Count(), 4, "All messages should be logged.")
 }
+
+func TestSequenceNumbers(t *testing.T) {
+	logger, _ := setup()
+	logger.SetLogLevel(DEBUG)
+
+	records := new(recordAppender)
+	ClearAppenders()
+	AddAppender(records)
+
+	logger.Error("one")
+	logger.Warn("two")
+	logger.Info("three")
+
+	WaitForIncoming()
+	logged := records.getRecords()
+	assert.Equal(t, len(logged), 3, "All messages should be logged.")
+	assert.True(t, logged[0].Seq > 0, "sequence numbers should be assigned")
+	assert.Equal(t, logged[1].Seq, logged[0].Seq+1, "sequence numbers should increase")
+	assert.Equal(t, logged[2].Seq, logged[1].Seq+1, "sequence numbers should increase")
+}
+
+func TestSequenceNumbersReplayed(t *testing.T) {
+	logger, _ := setup()
+	logger.SetLogLevel(ERROR)
+	logger.SetBufferLength(10)
+
+	records := new(recordAppender)
+	ClearAppenders()
+	AddAppender(records)
+
+	logger.Info("buffered")
+	logger.Error("error")
+
+	WaitForIncoming()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+
+	logged := records.getRecords()
+	assert.Equal(t, len(logged), 2, "Buffered message should be replayed.")
+	assert.Equal(t, logged[1].Message, "buffered", "Buffered message should be replayed.")
+	assert.Equal(t, logged[1].Seq, logged[0].Seq-1, "replayed messages keep their sequence number")
+}
+
+func TestSubmitRecord(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(WARN)
+
+	original := time.Now().Add(-time.Hour)
+	impl := logger.(*LoggerImpl)
+
+	SubmitRecord(NewLogRecord(impl, ERROR, nil, "error", time.Time{}, original))
+	SubmitRecord(NewLogRecord(impl, INFO, nil, "info", time.Time{}, time.Time{}))
+	SubmitRecord(&LogRecord{Level: ERROR, Message: "default"})
+	SubmitRecord(nil)
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"error", "default"}, "submitted records should be checked against their logger's level")
+}
+
+func TestAmbientTags(t *testing.T) {
+	logger, memory := setup()
+	memory.SetFormatter(GetFormatter(MINIMALTAGGED))
+	logger.SetLogLevel(DEBUG)
+
+	SetAmbientTagProvider(func() []string {
+		return []string{"request-1"}
+	})
+
+	tags := []string{"blit"}
+	logger.InfoWithTags(tags, "one")
+	logger.Info("two")
+
+	WaitForIncoming()
+	SetAmbientTagProvider(nil)
+
+	logger.Info("three")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages()[0], "[INFO] [blit request-1] one", "ambient tags should be added to the message tags")
+	assert.Equal(t, memory.GetLoggedMessages()[1], "[INFO] [request-1] two", "ambient tags should be added to untagged messages")
+	assert.Equal(t, memory.GetLoggedMessages()[2], "[INFO] three", "removing the provider should stop adding tags")
+	assert.Equal(t, tags, []string{"blit"}, "caller tags should not be modified")
+}
+
+func TestEventChannel(t *testing.T) {
+
+	events := make(chan LoggingEvent, 10)
+	logger, _ := setup()
+	logger.SetLogLevel(DEBUG)
+
+	errorApp := NewErrorAppender()
+	ClearAppenders()
+	AddAppender(NewNullAppender())
+	AddAppender(errorApp)
+
+	CaptureLoggingErrors(nil)
+	CaptureLoggingEvents(events)
+
+	logger.Error("error")
+	logger.Warn("warn")
+
+	event := <-events
+	assert.Equal(t, event.Err.Error(), "error: error", "events should be pushed to the channel in order.")
+	assert.Equal(t, event.Record.Message, "error", "events should include the record.")
+	assert.True(t, event.Appender == errorApp, "events should include the appender that failed.")
+	event = <-events
+	assert.Equal(t, event.Record.Message, "warn", "events should be pushed to the channel in order.")
+
+	WaitForIncoming()
+	CaptureLoggingEvents(nil)
+
+	select {
+	case event := <-events:
+		assert.Nil(t, event.Err, "only failing appenders should generate events")
+	default:
+		//ok
+	}
+}
+
+func TestLoadShedding(t *testing.T) {
+	blocking := NewBlockingAppender()
+	ClearAppenders()
+	AddAppender(blocking)
+
+	SetDefaultLogLevel(DEBUG)
+	SetLoadShedding(10, WARN)
+	before := DroppedCount()
+
+	for i := 0; i < 20; i++ {
+		Error("error")
+	}
+
+	for i := 0; i < 5; i++ {
+		Debug("debug")
+		Error("error")
+	}
+
+	SetLoadShedding(0, DEFAULT)
+	blocking.Unblock()
+	WaitForIncoming()
+
+	assert.Equal(t, DroppedCount()-before, 5, "Low severity messages should be dropped while the channel is backed up.")
+	assert.Equal(t, blocking.Count(), 25, "High severity messages should all be logged.")
+}
+
+func TestLoadSheddingWithBatchInFlight(t *testing.T) {
+	blocking := NewBlockingAppender()
+	ClearAppenders()
+	AddAppender(blocking)
+	SetDefaultLogLevel(DEBUG)
+
+	//queue the errors while paused so that they are all taken in one batch
+	PauseLogging()
+	for i := 0; i < 20; i++ {
+		Error("error")
+	}
+
+	SetLoadShedding(10, WARN)
+	before := DroppedCount()
+	RestartLogging()
+
+	for blocking.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, len(incomingChannel), 0, "the queued records should be in the batch being processed")
+
+	for i := 0; i < 5; i++ {
+		Debug("debug")
+	}
+
+	SetLoadShedding(0, DEFAULT)
+	blocking.Unblock()
+	WaitForIncoming()
+
+	assert.Equal(t, DroppedCount()-before, 5, "The batch being processed should count towards the shedding depth.")
+	assert.Equal(t, blocking.Count(), 20, "High severity messages should all be logged.")
+}
+
+func TestRecordTimesHaveNoMonotonicClock(t *testing.T) {
+	logger, _ := setup()
+	logger.SetLogLevel(ERROR)
+	logger.SetBufferLength(10)
+
+	records := new(recordAppender)
+	ClearAppenders()
+	AddAppender(records)
+
+	logger.Error("error")
+	logger.Info("buffered")
+
+	WaitForIncoming()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+
+	logged := records.getRecords()
+	assert.Equal(t, len(logged), 2, "Buffered message should be replayed.")
+
+	assert.True(t, logged[0].Time == logged[0].Original, "new records should have identical times")
+	assert.True(t, logged[0].Time == logged[0].Time.Round(0), "record times should not have a monotonic reading")
+
+	assert.False(t, logged[1].Time == logged[1].Original, "replayed records should have a new time")
+	assert.True(t, logged[1].Time == logged[1].Time.Round(0), "replayed times should not have a monotonic reading")
+	assert.True(t, logged[1].Original == logged[1].Original.Round(0), "original times should not have a monotonic reading")
+}
+
+func TestPauseFor(t *testing.T) {
+	logger, memory := setup()
+
+	PauseFor(50 * time.Millisecond)
+	logger.Info("paused")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "nothing is logged while paused")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"paused"}, "logging should restart after the duration")
+
+	PauseFor(10 * time.Millisecond)
+	RestartLogging()
+	PauseLogging()
+	time.Sleep(20 * time.Millisecond)
+	logger.Info("still paused")
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, len(memory.GetLoggedMessages()), 1, "an earlier PauseFor shouldn't restart a later pause")
+	RestartLogging()
+	WaitForIncoming()
+}
+
+func TestMaxPause(t *testing.T) {
+	logger, memory := setup()
+	errors := make(chan error, 10)
+	CaptureLoggingErrors(errors)
+	defer CaptureLoggingErrors(nil)
+	SetMaxPause(10 * time.Millisecond)
+	defer SetMaxPause(0)
+
+	PauseLogging()
+	logger.Info("forgotten")
+	WaitForIncoming()
+
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"forgotten"}, "logging should be restarted after the max pause")
+	err := <-errors
+	assert.Contains(t, err.Error(), "without being restarted", "the forced restart should be reported")
+}
+
+func TestHealthy(t *testing.T) {
+	logger, _ := setup()
+	SetHealthThreshold(10 * time.Millisecond)
+	defer SetHealthThreshold(DefaultHealthThreshold)
+
+	assert.True(t, Healthy(), "an idle logger is healthy")
+
+	blocking := NewBlockingAppender()
+	AddAppender(blocking)
+	logger.Info("stuck")
+	logger.Info("waiting")
+
+	assert.True(t, Healthy(), "waiting records aren't a problem at first")
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, Healthy(), "no progress past the threshold is reported")
+
+	blocking.Unblock()
+	WaitForIncoming()
+	assert.True(t, Healthy(), "progress is healthy again")
+
+	PauseLogging()
+	logger.Info("paused")
+	Healthy()
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, Healthy(), "a pause isn't a problem")
+	RestartLogging()
+	WaitForIncoming()
+}
+
+func TestStopAndDrain(t *testing.T) {
+	logger, memory := setup()
+
+	PauseLogging()
+	logger.Info("one")
+	logger.Warn("two")
+	logger.Error("three")
+
+	records := StopAndDrain()
+
+	defer restartAfterStop()
+
+	assert.Equal(t, len(records), 3, "the queued records should be returned")
+	assert.Equal(t, records[0].Message, "one", "the records should be oldest first")
+	assert.Equal(t, records[2].Message, "three", "the records should be oldest first")
+
+	logger.Info("after")
+	WaitForIncoming()
+	assert.Equal(t, len(incomingChannel), 0, "records logged after draining are discarded")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "nothing should be appended")
+}
+
+func TestStopLoggingDrains(t *testing.T) {
+	logger, memory := setup()
+
+	PauseLogging()
+	logger.Info("one")
+	logger.Warn("two")
+	logger.Error("three")
+
+	StopLogging()
+
+	defer restartAfterStop()
+
+	assert.Equal(t, len(incomingChannel), 0, "the queued records should be processed")
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"one", "two", "three"}, "the queued records should be appended before stopping")
+}
+
+func TestPauseAppenders(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(DEBUG)
+	logger.SetBufferLength(10)
+
+	PauseAppenders()
+
+	logger.Error("error")
+	logger.Info("info")
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "Paused appenders should not receive messages.")
+
+	ResumeAppenders()
+
+	logger.Warn("warn")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"warn"}, "Resumed appenders should receive new messages.")
+
+	logger.FlushBuffer()
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 3, "Messages logged while paused should be buffered and replayed.")
+}
+
+func TestNegativeBufferLength(t *testing.T) {
+	logger, memory := setup()
+	errors := make(chan error, 10)
+	CaptureLoggingErrors(errors)
+	defer CaptureLoggingErrors(nil)
+
+	logger.SetBufferLength(-1)
+	assert.Nil(t, logger.(*LoggerImpl).buffer, "a negative length should remove the buffer")
+
+	err := <-errors
+	assert.Contains(t, err.Error(), "negative", "a negative length should be reported")
+
+	logger.SetLogLevel(ERROR)
+	logger.Info("info")
+	WaitForIncoming()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "nothing is buffered")
+}
+
+func TestNewLoggerWithoutDefaultBuffer(t *testing.T) {
+	setup()
+	SetDefaultBufferLength(0)
+
+	logger := GetLogger(fmt.Sprintf("testLogger-%d", count))
+	count++
+
+	assert.Nil(t, logger.(*LoggerImpl).buffer, "new loggers copy the default logger's missing buffer")
+
+	SetDefaultBufferLength(3)
+	assert.Equal(t, logger.(*LoggerImpl).buffer.Len(), 3, "loggers without a buffer get the new default length")
+	SetDefaultBufferLength(0)
+}
+
+func TestDisableBuffering(t *testing.T) {
+	logger, memory := setup()
+	logger.SetBufferLength(10)
+	SetTagBufferLength("payment", 10)
+	logger.SetLogLevel(ERROR)
+
+	logger.InfoWithTags([]string{"payment"}, "one")
+	WaitForIncoming()
+
+	DisableBuffering()
+	assert.Nil(t, logger.(*LoggerImpl).buffer, "existing buffers should be removed")
+	assert.Nil(t, defaultLogger.buffer, "the default buffer should be removed")
+	assert.Equal(t, len(tagBuffers), 0, "tag buffers should be removed")
+
+	created := GetLogger(fmt.Sprintf("testLogger-%d", count)).(*LoggerImpl)
+	count++
+	assert.Nil(t, created.buffer, "new loggers shouldn't get a buffer")
+
+	logger.SetLogLevel(INFO)
+	FlushTagBuffer("payment")
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "buffered records are dropped")
+
+	SetDefaultBufferLength(3)
+	assert.Equal(t, logger.(*LoggerImpl).buffer.Len(), 3, "setting the default length turns buffering back on")
+	SetDefaultBufferLength(0)
+}
+
+func TestReplayBufferTo(t *testing.T) {
+	logger, memory := setupImpl()
+	logger.SetLogLevel(ERROR)
+	logger.SetBufferLength(10)
+
+	logger.Info("one")
+	logger.Warn("two")
+	WaitForIncoming()
+
+	target := NewMemoryAppender()
+	target.SetFormatter(GetFormatter(MINIMAL))
+
+	assert.Nil(t, logger.ReplayBufferTo(target))
+	assert.Equal(t, target.GetLoggedMessages(), []string{"one", "two"}, "buffered records should be written to the appender")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "the global appenders shouldn't see the replay")
+
+	assert.Nil(t, logger.ReplayBufferTo(target))
+	assert.Equal(t, len(target.GetLoggedMessages()), 4, "the buffer shouldn't be cleared")
+
+	assert.NotNil(t, logger.ReplayBufferTo(NewErrorAppender()), "appender errors should be returned")
+
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 2, "the buffer should still replay to the global appenders")
+}
+
+type closingAppender struct {
+	NullAppender
+	closed int
+}
+
+func (appender *closingAppender) Close() error {
+	appender.closed++
+	return nil
+}
+
+func TestReplaceAppenders(t *testing.T) {
+	logger, memory := setup()
+
+	kept := new(closingAppender)
+	removed := new(closingAppender)
+	AddAppender(kept)
+	AddAppender(removed)
+
+	replacement := NewMemoryAppender()
+	replacement.SetFormatter(GetFormatter(MINIMAL))
+	list := []LogAppender{kept, replacement}
+	ReplaceAppenders(list)
+	list[0] = nil
+
+	logger.Info("one")
+	WaitForIncoming()
+
+	assert.Equal(t, len(memory.GetLoggedMessages()), 0, "replaced appenders shouldn't get records")
+	assert.Equal(t, replacement.GetLoggedMessages(), []string{"one"}, "new appenders should get records")
+	assert.Equal(t, kept.Count(), 1, "appenders in both lists should keep getting records")
+	assert.Equal(t, kept.closed, 0, "appenders in both lists shouldn't be closed")
+	assert.Equal(t, removed.closed, 1, "removed appenders should be closed")
+}
+
+func TestMaxMessageLength(t *testing.T) {
+	logger, memory := setup()
+
+	SetMaxMessageLength(5)
+	defer SetMaxMessageLength(0)
+
+	logger.Info("12345")
+	logger.Infof("%s", "123456")
+	logger.Info("1234é")
+	logger.Info("123é")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"12345", "12345…[truncated]", "1234…[truncated]", "123é"}, "long messages should be cut on a character boundary")
+}
+
+func TestStrictTags(t *testing.T) {
+	logger, memory := setup()
+	memory.SetFormatter(GetFormatter(MINIMALTAGGED))
+	errors := make(chan error, 10)
+	CaptureLoggingErrors(errors)
+	defer CaptureLoggingErrors(nil)
+
+	logger.InfoWithTags([]string{"one", ""}, "before")
+	WaitForIncoming()
+
+	SetStrictTags(true)
+	defer SetStrictTags(false)
+
+	tags := []string{"", "one", " "}
+	logger.InfoWithTags(tags, "after")
+	WaitForIncoming()
+
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"[INFO] [one ] before", "[INFO] [one] after"}, "strict tags should remove empty tags")
+	assert.Equal(t, tags, []string{"", "one", " "}, "the tags passed in shouldn't change")
+	assert.Contains(t, (<-errors).Error(), "2 empty tags", "removed tags should be reported")
+
+	assert.Equal(t, AddTag([]string{"one"}, "\t"), []string{"one"}, "AddTag should skip empty tags")
+	assert.NotNil(t, <-errors, "skipped tags should be reported")
+}
+
+func TestStackCaptureLevel(t *testing.T) {
+	logger, _ := setup()
+
+	app := new(recordAppender)
+	AddAppender(app)
+
+	SetStackCaptureLevel(ERROR)
+	defer SetStackCaptureLevel(DEFAULT)
+
+	logger.Warn("one")
+	logger.Errorf("%s", "two")
+	Error("three")
+	<-LogAndConfirm(ERROR, nil, "four")
+
+	WaitForIncoming()
+	records := app.getRecords()
+
+	assert.Equal(t, records[0].Stack, "", "records below the level don't get a stack")
+	assert.Nil(t, records[0].Frames, "records below the level don't get frames")
+
+	for _, record := range records[1:] {
+		assert.True(t, strings.HasPrefix(record.Stack, "github.com/glitchdotcom/logging.TestStackCaptureLevel\n"), "the stack should start at the caller: "+record.Stack)
+		assert.Equal(t, record.Frames[0].Function, "github.com/glitchdotcom/logging.TestStackCaptureLevel", "the frames should start at the caller")
+		assert.Equal(t, strings.Count(record.Stack, "\n\t"), len(record.Frames), "the frames should match the stack")
+	}
+
+	memory := NewMemoryAppender()
+	memory.SetFormatter(GetFormatter(MINIMAL))
+	memory.Log(records[1])
+	assert.True(t, strings.HasPrefix(memory.GetLoggedMessages()[0], "two\ngithub.com/glitchdotcom/logging.TestStackCaptureLevel\n\t"), "formatted records should include the stack")
+
+	SetStackCaptureLevel(DEFAULT)
+	logger.Error("five")
+	WaitForIncoming()
+	assert.Equal(t, app.getRecords()[4].Stack, "", "stacks can be turned off")
+}
+
+func TestClosedErrorChannel(t *testing.T) {
+	logger, _ := setup()
+	AddAppender(NewErrorAppender())
+
+	errors := make(chan error, 10)
+	events := make(chan LoggingEvent, 10)
+	CaptureLoggingErrors(errors)
+	CaptureLoggingEvents(events)
+	defer CaptureLoggingErrors(nil)
+	defer CaptureLoggingEvents(nil)
+
+	close(errors)
+	close(events)
+
+	logger.Info("one")
+	WaitForIncoming()
+
+	assert.True(t, <-LogAndConfirm(INFO, nil, "two") != nil, "logging should continue after the channels are closed")
+}
+
+func TestLogAndConfirm(t *testing.T) {
+	logger, memory := setupImpl()
+
+	assert.Nil(t, <-logger.LogAndConfirm(INFO, nil, "one"), "the record should be confirmed")
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"one"}, "the record is written before it is confirmed")
+
+	assert.NotNil(t, <-logger.LogAndConfirm(DEBUG, nil, "two"), "records below the level aren't logged")
+
+	AddAppender(NewErrorAppender())
+	AddAppender(NewErrorAppender())
+	err := <-LogAndConfirm(WARN, []string{"audit"}, "three")
+	assert.Contains(t, err.Error(), "2 appenders failed", "appender errors should be combined")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 2, "other appenders still get the record")
+}
+
+func TestSynchronous(t *testing.T) {
+	logger, memory := setup()
+
+	SetSynchronous(true)
+	defer SetSynchronous(false)
+
+	PauseLogging()
+	logger.Info("one")
+	logger.Infof("%s", "two")
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"one", "two"}, "synchronous records are appended before the call returns")
+	RestartLogging()
+
+	SetSynchronous(false)
+	logger.Info("three")
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"one", "two", "three"}, "records are queued again after switching back")
+}
+
+func TestTagBuffer(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(ERROR)
+	logger.SetBufferLength(10)
+
+	other := GetLogger(fmt.Sprintf("testLogger-%d", count))
+	count++
+	other.SetLogLevel(ERROR)
+
+	SetTagBufferLength("payment", 5)
+	defer SetTagBufferLength("payment", 0)
+
+	logger.InfoWithTags([]string{"payment"}, "one")
+	other.WarnWithTags([]string{"payment", "payment"}, "two")
+	other.Info("three")
+	logger.ErrorWithTags([]string{"payment"}, "logged")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"logged"}, "records below the level should be buffered")
+
+	FlushTagBuffer("payment")
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"logged", "one", "two"}, "tagged records from every logger should be flushed together")
+
+	FlushTagBuffer("payment")
+	FlushTagBuffer("unknown")
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 3, "records are only flushed once")
+
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 3, "records flushed by tag are removed from the logger buffer")
+
+	logger.SetLogLevel(ERROR)
+	logger.InfoWithTags([]string{"payment"}, "four")
+	WaitForIncoming()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+	FlushTagBuffer("payment")
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages()[3:], []string{"four"}, "records flushed by logger are removed from the tag buffer")
+}
+
+func TestFlushTagBufferWhileLogging(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(ERROR)
+
+	SetTagBufferLength("payment", 100)
+	defer SetTagBufferLength("payment", 0)
+
+	flushed := make(map[string]int)
+	lock := new(sync.Mutex)
+
+	SetBufferFlushHook(func(name string, count int) {
+		lock.Lock()
+		flushed[name] += count
+		lock.Unlock()
+	})
+	defer SetBufferFlushHook(nil)
+
+	for i := 0; i < 50; i++ {
+		logger.InfoWithTags([]string{"payment"}, "tagged")
+	}
+	WaitForIncoming()
+
+	before := GetStats()
+	waiter := new(sync.WaitGroup)
+	waiter.Add(1)
+
+	go func() {
+		for i := 0; i < 200; i++ {
+			logger.Error("error")
+		}
+		waiter.Done()
+	}()
+
+	FlushTagBuffer("payment")
+	waiter.Wait()
+	WaitForIncoming()
+
+	tagged := 0
+	for _, message := range memory.GetLoggedMessages() {
+		if message == "tagged" {
+			tagged++
+		}
+	}
+
+	after := GetStats()
+
+	assert.Equal(t, tagged, 50, "every buffered record should be flushed")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 250, "records logged during the flush should not be lost")
+	assert.Equal(t, after.Replayed-before.Replayed, uint64(50), "the flushed records should be counted as replayed")
+	assert.Equal(t, after.FlushOccupancy[FlushOverHalf]-before.FlushOccupancy[FlushOverHalf], uint64(1), "a half full tag buffer should be counted over half")
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, flushed["tag:payment"], 50, "the hook should report the tag flush")
+}
+
+func TestFlushBuffer(t *testing.T) {
+	logger, memory := setup()
+	memory.SetFormatter(GetFormatter(FULL))
+	logger.SetLogLevel(ERROR)
+	logger.SetBufferLength(10)
+
+	logger.Info("info")
+	logger.Error("error")
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 1, "Only messages at level ERROR should be logged.")
+
+	logger.FlushBuffer()
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 1, "Flushed messages are checked against the level again.")
+
+	PauseAppenders()
+	logger.Error("paused")
+	WaitForIncoming()
+	ResumeAppenders()
+
+	logger.FlushBuffer()
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 2, "Flushed messages that pass should be logged.")
+	assert.Contains(t, memory.GetLoggedMessages()[1], "[replayed from", "Flushed messages should be replayed.")
+
+	logger.SetLogLevel(INFO)
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 3, "Messages that didn't pass should stay buffered.")
+}
+
+func BenchmarkNullAppender(b *testing.B) {
+	ClearAppenders()
+	AddAppender(NewNullAppender())
+	SetDefaultLogLevel(INFO)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info("benchmark")
+	}
+	WaitForIncoming()
+}
+
+func BenchmarkProcessOneAtATime(b *testing.B) {
+	benchmarkProcessBatchSize(b, 1)
+}
+
+func BenchmarkProcessBatched(b *testing.B) {
+	benchmarkProcessBatchSize(b, DefaultProcessBatchSize)
+}
+
+func benchmarkProcessBatchSize(b *testing.B, size int) {
+	ClearAppenders()
+	AddAppender(NewNullAppender())
+	AddAppender(NewNullAppender())
+	SetDefaultLogLevel(INFO)
+	SetProcessBatchSize(size)
+	defer SetProcessBatchSize(DefaultProcessBatchSize)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info("benchmark")
+	}
+	WaitForIncoming()
+}
+
+func BenchmarkInfof(b *testing.B) {
+	ClearAppenders()
+	AddAppender(NewNullAppender())
+	SetDefaultLogLevel(INFO)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Infof("benchmark count=%d", int64(i))
+	}
+	WaitForIncoming()
+}
+
+func BenchmarkInfoKV(b *testing.B) {
+	ClearAppenders()
+	AddAppender(NewNullAppender())
+	SetDefaultLogLevel(INFO)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		InfoKV("benchmark", "count", int64(i))
+	}
+	WaitForIncoming()
+}
+
+func BenchmarkDiscardFormatter(b *testing.B) {
+	app := NewWriterAppender(ioutil.Discard)
+	app.SetFormatter(DiscardFormatter)
+	ClearAppenders()
+	AddAppender(app)
+	SetDefaultLogLevel(INFO)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info("benchmark")
+	}
+	WaitForIncoming()
+}
+
+func TestReplayedFlag(t *testing.T) {
+	logger, memory := setup()
+	memory.SetFormatter(GetFormatter(FULL))
+	logger.SetLogLevel(ERROR)
+	logger.SetBufferLength(10)
+
+	records := new(recordAppender)
+	AddAppender(records)
+
+	now := time.Now()
+	SubmitRecord(&LogRecord{Level: ERROR, Message: "historical", Time: now, Original: now.Add(-time.Hour)})
+	SubmitRecord(&LogRecord{Level: ERROR, Message: "forwarded", Time: now, Original: now.Add(-time.Hour), Replayed: true})
+	logger.Info("buffered")
+
+	WaitForIncoming()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+
+	logged := records.getRecords()
+	assert.Equal(t, len(logged), 3, "all messages should be logged")
+	assert.False(t, logged[0].Replayed, "new records aren't replayed")
+	assert.True(t, logged[2].Replayed, "buffered records are replayed")
+
+	messages := memory.GetLoggedMessages()
+	assert.NotContains(t, messages[0], "[replayed from", "records are only shown as replayed if they are flagged")
+	assert.Contains(t, messages[1], "[replayed from", "flagged records are shown as replayed")
+	assert.Contains(t, messages[2], "[replayed from", "buffered records are shown as replayed")
+}
+
+func TestMuteTag(t *testing.T) {
+	logger, memory := setup()
+	logger.SetLogLevel(DEBUG)
+	logger.SetTagLevel("noisy", DEBUG)
+	logger.SetBufferLength(10)
+
+	MuteTag("noisy")
+
+	assert.False(t, logger.CheckLevel(ERROR, []string{"other", "noisy"}), "muted tags should fail every level")
+
+	logger.ErrorWithTags([]string{"noisy"}, "muted")
+	logger.ErrorWithTags([]string{"quiet"}, "error")
+	logger.Error("error")
+
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 2, "messages with muted tags should be dropped")
+
+	UnmuteTag("noisy")
+	logger.FlushBuffer()
+	logger.ErrorWithTags([]string{"noisy"}, "unmuted")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages()[2], "unmuted", "muted messages should not be buffered")
+	assert.Equal(t, len(memory.GetLoggedMessages()), 3, "unmuted tags should be logged")
+}
+
+func TestBufferFlushHook(t *testing.T) {
+	logger, _ := setup()
+	logger.SetLogLevel(ERROR)
+	logger.SetBufferLength(10)
+
+	flushed := make(map[string]int)
+	lock := new(sync.Mutex)
+
+	SetBufferFlushHook(func(name string, count int) {
+		lock.Lock()
+		flushed[name] += count
+		lock.Unlock()
+	})
+
+	logger.Info("one")
+	logger.Debug("two")
+	logger.Error("three")
+
+	WaitForIncoming()
+	logger.SetLogLevel(DEBUG)
+	SetBufferFlushHook(nil)
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, flushed[logger.(*LoggerImpl).name], 2, "the hook should report the replayed records")
+}
+
+func TestBatchAppender(t *testing.T) {
+	logger, memory := setup()
+	batcher := new(batchAppender)
+	AddAppender(batcher)
+	logger.SetLogLevel(WARN)
+
+	PauseLogging()
+	logger.Warn("one")
+	logger.Info("skipped")
+	logger.Warn("two")
+	logger.Error("three")
+	RestartLogging()
+	WaitForIncoming()
+
+	assert.Equal(t, batcher.getBatches(), []int{3}, "queued records that pass should be logged as one batch")
+	assert.Equal(t, len(batcher.getRecords()), 3, "the batch should have the records")
+	assert.Equal(t, batcher.getRecords()[2].Message, "three", "the batch should be in order")
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"one", "two", "three"}, "other appenders get each record")
+
+	logger.Warn("four")
+	WaitForIncoming()
+	assert.Equal(t, len(batcher.getRecords()), 4, "a single record is logged with Log")
+}
+
+func TestProcessBatchSize(t *testing.T) {
+	logger, _ := setup()
+	batcher := new(batchAppender)
+	AddAppender(batcher)
+	SetProcessBatchSize(2)
+	defer SetProcessBatchSize(DefaultProcessBatchSize)
+
+	PauseLogging()
+	for i := 0; i < 5; i++ {
+		logger.Info("queued")
+	}
+	RestartLogging()
+	WaitForIncoming()
+
+	assert.Equal(t, batcher.getBatches(), []int{2, 2}, "batches should be limited to the size, the last record is logged alone")
+	assert.Equal(t, len(batcher.getRecords()), 5, "every record should be logged")
+}
+
+func TestBatchAppenderCanKeepTheSlice(t *testing.T) {
+	logger, _ := setup()
+	batcher := new(batchAppender)
+	AddAppender(batcher)
+
+	for _, messages := range [][]string{{"one", "two"}, {"three", "four", "five"}} {
+		PauseLogging()
+		for _, message := range messages {
+			logger.Info(message)
+		}
+		RestartLogging()
+		WaitForIncoming()
+	}
+
+	kept := batcher.getKept()
+	assert.Equal(t, len(kept), 2, "each batch should be passed once")
+
+	var messages []string
+	for _, batch := range kept {
+		for _, record := range batch {
+			assert.NotNil(t, record, "a kept slice shouldn't be cleared after LogBatch returns")
+			messages = append(messages, record.Message)
+		}
+	}
+	assert.Equal(t, messages, []string{"one", "two", "three", "four", "five"}, "a kept slice shouldn't be reused for later batches")
+}
+
+func TestBatchAppenderError(t *testing.T) {
+	logger, _ := setupImpl()
+	ClearAppenders()
+	AddAppender(&failingBatchAppender{})
+
+	PauseLogging()
+	first := logger.LogAndConfirm(INFO, nil, "one")
+	second := logger.LogAndConfirm(INFO, nil, "two")
+	RestartLogging()
+
+	assert.NotNil(t, <-first, "a batch error is the result for every record")
+	assert.NotNil(t, <-second, "a batch error is the result for every record")
+}
+
+type failingBatchAppender struct {
+	recordAppender
+}
+
+func (appender *failingBatchAppender) LogBatch(records []*LogRecord) error {
+	return fmt.Errorf("failed")
+}
+
+func TestLogAt(t *testing.T) {
+	logger, _ := setupImpl()
+	records := new(recordAppender)
+	AddAppender(records)
+
+	when := time.Date(2020, 5, 6, 7, 8, 9, 0, time.UTC)
+	logger.LogAt(when, WARN, []string{"import"}, "historical")
+	LogAt(when, DEBUG, nil, "filtered")
+	WaitForIncoming()
+
+	logged := records.getRecords()
+	assert.Equal(t, len(logged), 1, "the level should still be checked")
+	assert.Equal(t, logged[0].Message, "historical")
+	assert.True(t, logged[0].Time.Equal(when), "the time should be used")
+	assert.True(t, logged[0].Original.Equal(when), "the original time should be the same")
+	assert.Equal(t, logged[0].Tags, []string{"import"})
+}
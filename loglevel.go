@@ -1,6 +1,10 @@
 package logging
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
 
 //LogLevel is the type used to indicate the importance of a logging request
 type LogLevel uint8
@@ -21,8 +25,56 @@ const (
 	ERROR
 )
 
-//String converts a log level to an upper case string
+//customLevels holds the names of levels registered above ERROR, it has its own lock
+//because levels are converted to strings while the logging lock is held
+var customLevels = make(map[LogLevel]string)
+var customLevelMutex = new(sync.RWMutex)
+
+//RegisterLevel names a custom level above ERROR, for example a level that pages someone. The name
+//is used by String and LevelFromString, registering a level again replaces its name. Custom levels
+//are logged with LogWithTags or LogWithTagsf and are treated as more severe than ERROR everywhere else.
+func RegisterLevel(level LogLevel, name string) error {
+	if level <= ERROR {
+		return fmt.Errorf("custom level %d must be above ERROR", level)
+	}
+
+	customLevelMutex.Lock()
+	customLevels[level] = strings.ToUpper(name)
+	customLevelMutex.Unlock()
+	return nil
+}
+
+//customLevelName returns the registered name for a level, if there is one
+func customLevelName(level LogLevel) (string, bool) {
+	customLevelMutex.RLock()
+	defer customLevelMutex.RUnlock()
+
+	name, ok := customLevels[level]
+	return name, ok
+}
+
+//customLevelFromName finds a registered level by its lower case name
+func customLevelFromName(str string) (LogLevel, bool) {
+	customLevelMutex.RLock()
+	defer customLevelMutex.RUnlock()
+
+	for level, name := range customLevels {
+		if strings.ToLower(name) == str {
+			return level, true
+		}
+	}
+
+	return DEFAULT, false
+}
+
+//String converts a log level to an upper case string, custom levels use their registered name
 func (level LogLevel) String() string {
+	if level > ERROR {
+		if name, ok := customLevelName(level); ok {
+			return name
+		}
+	}
+
 	switch {
 	case level >= ERROR:
 		return "ERROR"
@@ -37,25 +89,57 @@ func (level LogLevel) String() string {
 	}
 }
 
+//MoreSevereThan returns true if the level is more severe than the other level, ERROR is more severe
+//than WARN, and custom levels are more severe than ERROR
+func (level LogLevel) MoreSevereThan(other LogLevel) bool {
+	return level > other
+}
+
+//LessSevereThan returns true if the level is more verbose than the other level, DEBUG is less severe than INFO
+func (level LogLevel) LessSevereThan(other LogLevel) bool {
+	return level < other
+}
+
+//Enabled returns true if a record at the level passes the threshold, which is the test loggers and
+//appenders use, a record passes if it is at least as severe as the threshold. Every level passes a
+//DEFAULT threshold, a logger with the DEFAULT level uses the default logger's level instead.
+func (level LogLevel) Enabled(threshold LogLevel) bool {
+	return threshold <= level
+}
+
 /*
-LevelFromString converts a level in any case to a LogLevel, valid values are
-error, warning, warn, info, informative, debug and verbose.
+ParseLevel converts a level in any case to a LogLevel, valid values are default,
+error, warning, warn, info, informative, debug, verbose and the names of
+registered custom levels. Unlike LevelFromString an unknown value is an error,
+so that typos in configuration can be reported.
 */
-func LevelFromString(str string) LogLevel {
-	str = strings.ToLower(str)
-
-	switch str {
+func ParseLevel(str string) (LogLevel, error) {
+	switch strings.ToLower(str) {
+	case "default":
+		return DEFAULT, nil
 	case "error":
-		return ERROR
+		return ERROR, nil
 	case "warning", "warn":
-		return WARN
+		return WARN, nil
 	case "info", "informative":
-		return INFO
+		return INFO, nil
 	case "debug":
-		return DEBUG
+		return DEBUG, nil
 	case "verbose":
-		return VERBOSE
+		return VERBOSE, nil
 	default:
-		return DEFAULT
+		if level, ok := customLevelFromName(strings.ToLower(str)); ok {
+			return level, nil
+		}
+		return DEFAULT, fmt.Errorf("unknown log level %q", str)
 	}
 }
+
+/*
+LevelFromString converts a level in any case to a LogLevel, like ParseLevel,
+but returns DEFAULT for unknown values instead of an error.
+*/
+func LevelFromString(str string) LogLevel {
+	level, _ := ParseLevel(str)
+	return level
+}
@@ -26,6 +26,41 @@ func TestFromString(t *testing.T) {
 	}
 }
 
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("Warning")
+	assert.Nil(t, err, "known levels should parse")
+	assert.Equal(t, level, WARN)
+
+	level, err = ParseLevel("default")
+	assert.Nil(t, err, "default is a known level")
+	assert.Equal(t, level, DEFAULT)
+
+	_, err = ParseLevel("inf\n\no")
+	assert.NotNil(t, err, "unknown levels should be an error")
+	assert.Contains(t, err.Error(), "unknown log level", "the error should say the level is unknown")
+
+	_, err = ParseLevel("")
+	assert.NotNil(t, err, "an empty level should be an error")
+
+	assert.Nil(t, RegisterLevel(ERROR+3, "alarm"))
+	level, err = ParseLevel("ALARM")
+	assert.Nil(t, err, "custom levels should parse")
+	assert.Equal(t, level, LogLevel(ERROR+3))
+}
+
+func TestLevelComparisons(t *testing.T) {
+	assert.True(t, ERROR.MoreSevereThan(WARN), "ERROR is more severe than WARN")
+	assert.False(t, WARN.MoreSevereThan(WARN), "a level isn't more severe than itself")
+	assert.True(t, LogLevel(ERROR+1).MoreSevereThan(ERROR), "custom levels are more severe than ERROR")
+	assert.True(t, VERBOSE.LessSevereThan(DEBUG), "VERBOSE is less severe than DEBUG")
+	assert.False(t, INFO.LessSevereThan(DEBUG), "INFO isn't less severe than DEBUG")
+
+	assert.True(t, WARN.Enabled(INFO), "WARN passes an INFO threshold")
+	assert.True(t, INFO.Enabled(INFO), "a level passes its own threshold")
+	assert.False(t, DEBUG.Enabled(INFO), "DEBUG doesn't pass an INFO threshold")
+	assert.True(t, VERBOSE.Enabled(DEFAULT), "every level passes a DEFAULT threshold")
+}
+
 func TestCheckLevel(t *testing.T) {
 
 	logger := DefaultLogger()
@@ -393,3 +428,137 @@ func BenchmarkTagFailedMapLookup(b *testing.B) {
 		_, _ = theMap["a"]
 	}
 }
+
+func TestClearTagLevel(t *testing.T) {
+
+	logger, memory := setupImpl()
+	logger.SetLogLevel(ERROR)
+	logger.SetTagLevel("one", DEBUG)
+	logger.SetTagLevel("two", DEBUG)
+
+	logger.InfoWithTags([]string{"one"}, "a")
+	WaitForIncoming()
+	logger.ClearTagLevel("one")
+	logger.InfoWithTags([]string{"one"}, "b")
+	logger.InfoWithTags([]string{"two"}, "c")
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"a", "c"}, "a cleared tag should use the general level")
+
+	logger.ClearTagLevels()
+	logger.InfoWithTags([]string{"two"}, "d")
+	WaitForIncoming()
+	assert.Equal(t, len(memory.GetLoggedMessages()), 2, "all tag levels should be cleared")
+	assert.Nil(t, logger.tagLevels, "the map should be released")
+
+	SetDefaultTagLogLevel("three", DEBUG)
+	SetDefaultTagLogLevel("four", DEBUG)
+	ClearDefaultTagLogLevel("three")
+	assert.False(t, CheckLevel(DEBUG, []string{"three"}), "the default tag level should be cleared")
+	assert.True(t, CheckLevel(DEBUG, []string{"four"}), "other default tag levels are kept")
+	ClearDefaultTagLogLevels()
+	assert.False(t, CheckLevel(DEBUG, []string{"four"}), "all default tag levels should be cleared")
+}
+
+func TestWouldLog(t *testing.T) {
+
+	logger, memory := setupImpl()
+	logger.SetLogLevel(DEBUG)
+	memory.SetLevel(WARN)
+
+	assert.True(t, logger.CheckLevel(INFO, nil), "Info passes the logger level")
+	assert.False(t, logger.WouldLog(INFO, nil), "Info should not be logged when the only appender is at Warn")
+	assert.True(t, logger.WouldLog(WARN, nil), "Warn should be logged when the appender is at Warn")
+
+	secondAppender := NewMemoryAppender()
+	secondAppender.SetLevel(INFO)
+	AddAppender(secondAppender)
+
+	assert.True(t, logger.WouldLog(INFO, nil), "Info should be logged when any appender accepts it")
+	assert.False(t, logger.WouldLog(VERBOSE, nil), "Verbose doesn't pass the logger level")
+
+	SetDefaultLogLevel(ERROR)
+	assert.False(t, WouldLog(WARN, nil), "Warn doesn't pass the default logger level")
+	assert.True(t, WouldLog(ERROR, nil), "Error passes the default logger level and the appenders")
+}
+
+func TestWouldLogCache(t *testing.T) {
+
+	logger, memory := setupImpl()
+	logger.SetLogLevel(DEBUG)
+
+	assert.True(t, logger.WouldLog(DEBUG, nil), "Debug passes the logger and the appender")
+
+	memory.SetLevel(WARN)
+	assert.False(t, logger.WouldLog(DEBUG, nil), "changing an appender level should clear the cache")
+	assert.True(t, logger.WouldLog(WARN, nil), "Warn passes the logger and the appender")
+
+	secondAppender := NewMemoryAppender()
+	secondAppender.SetLevel(DEBUG)
+	AddAppender(secondAppender)
+	assert.True(t, logger.WouldLog(DEBUG, nil), "adding an appender should clear the cache")
+
+	ClearAppenders()
+	assert.False(t, logger.WouldLog(ERROR, nil), "nothing is logged without appenders")
+
+	AddAppender(NewNullAppender())
+	SetDefaultLogLevel(INFO)
+	assert.True(t, WouldLog(INFO, nil), "appenders at the DEFAULT level accept everything")
+	assert.False(t, WouldLog(DEBUG, nil), "Debug doesn't pass the default logger level")
+
+	custom := &customLevelAppender{level: ERROR}
+	ClearAppenders()
+	AddAppender(custom)
+	assert.False(t, WouldLog(WARN, nil), "appenders with their own CheckLevel are asked")
+
+	custom.level = WARN
+	assert.False(t, WouldLog(WARN, nil), "the cached levels aren't rebuilt on their own")
+	AppenderLevelsChanged()
+	assert.True(t, WouldLog(WARN, nil), "AppenderLevelsChanged should clear the cache")
+}
+
+type customLevelAppender struct {
+	NullAppender
+	level LogLevel
+}
+
+func (appender *customLevelAppender) CheckLevel(level LogLevel) bool {
+	return level >= appender.level
+}
+
+func TestLoggerLevel(t *testing.T) {
+
+	logger, _ := setup()
+	SetDefaultLogLevel(WARN)
+
+	assert.Equal(t, DefaultLevel(), WARN, "default level should be reported")
+	assert.Equal(t, logger.Level(), WARN, "loggers with the DEFAULT level should report the default level")
+
+	logger.SetLogLevel(DEBUG)
+	assert.Equal(t, logger.Level(), DEBUG, "loggers should report their own level")
+	assert.Equal(t, DefaultLevel(), WARN, "default level should be unchanged")
+}
+
+func TestCustomLevels(t *testing.T) {
+
+	page := LogLevel(ERROR + 2)
+
+	assert.NotNil(t, RegisterLevel(ERROR, "broken"), "custom levels must be above error")
+	assert.Nil(t, RegisterLevel(page, "page"), "custom levels above error can be registered")
+
+	assert.Equal(t, page.String(), "PAGE", "custom levels use their name")
+	assert.Equal(t, LogLevel(ERROR+1).String(), "ERROR", "unregistered levels above error are errors")
+	assert.Equal(t, LevelFromString("Page"), page, "custom levels can be parsed")
+	assert.Equal(t, LevelFromString("broken"), DEFAULT, "rejected levels are not registered")
+
+	logger, memory := setupImpl()
+	memory.SetFormatter(GetFormatter(MINIMALTAGGED))
+	logger.SetLogLevel(ERROR)
+
+	logger.LogWithTags(page, nil, "one")
+	logger.LogWithTagsf(page, []string{"ops"}, "%v", "two")
+	logger.LogWithTags(WARN, nil, "three")
+	LogWithTagsf(page, nil, "four")
+
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"[PAGE] one", "[PAGE] [ops] two", "[PAGE] four"}, "custom levels should be logged above error")
+}
@@ -0,0 +1,95 @@
+package logging
+
+/*
+RingAppender keeps copies of the last records that pass its level, in memory, so they can be searched
+with Query, for example from a debug endpoint. Memory use is bounded by the size given when the appender
+is created, older records are dropped as new ones arrive. The formatter is not used.
+*/
+type RingAppender struct {
+	BaseLogAppender
+	records []*LogRecord
+	next    int
+	full    bool
+}
+
+//NewRingAppender creates an appender that keeps the last size records, the size must be at least 1
+func NewRingAppender(size int) *RingAppender {
+	if size < 1 {
+		size = 1
+	}
+
+	return &RingAppender{records: make([]*LogRecord, size)}
+}
+
+//Log checks the record's level and keeps a copy of it, replacing the oldest record if the ring is full
+func (appender *RingAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if !appender.checkLevel(record.Level) {
+		return nil
+	}
+
+	appender.records[appender.next] = cloneRecord(record)
+	appender.next++
+
+	if appender.next == len(appender.records) {
+		appender.next = 0
+		appender.full = true
+	}
+
+	return nil
+}
+
+//Query returns copies of the most recent records at or above the minimum level that have all of the tags,
+//oldest first. A nil or empty tag list matches every record, a limit of 0 or less returns every match.
+func (appender *RingAppender) Query(minLevel LogLevel, tags []string, limit int) []*LogRecord {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+
+	var matches []*LogRecord
+	count := appender.next
+
+	if appender.full {
+		count = len(appender.records)
+	}
+
+	//walk from the newest record back, so the limit keeps the most recent matches
+	for i := 0; i < count; i++ {
+		if limit > 0 && len(matches) == limit {
+			break
+		}
+
+		index := (appender.next - 1 - i + len(appender.records)) % len(appender.records)
+		record := appender.records[index]
+
+		if record.Level >= minLevel && hasAllTags(record.Tags, tags) {
+			matches = append(matches, cloneRecord(record))
+		}
+	}
+
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+
+	return matches
+}
+
+func hasAllTags(recordTags []string, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+
+		for _, recordTag := range recordTags {
+			if recordTag == tag {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
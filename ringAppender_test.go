@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func messagesOf(records []*LogRecord) []string {
+	messages := make([]string, len(records))
+	for i, record := range records {
+		messages[i] = record.Message
+	}
+	return messages
+}
+
+func TestRingAppender(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(DEBUG)
+
+	app := NewRingAppender(4)
+	AddAppender(app)
+
+	Debug("one")
+	InfoWithTags([]string{"db"}, "two")
+	WarnWithTags([]string{"db", "slow"}, "three")
+	Error("four")
+	ErrorWithTags([]string{"db"}, "five")
+
+	WaitForIncoming()
+	ClearAppenders()
+
+	assert.Equal(t, messagesOf(app.Query(DEBUG, nil, 0)), []string{"two", "three", "four", "five"}, "the oldest record should be dropped")
+	assert.Equal(t, messagesOf(app.Query(WARN, nil, 0)), []string{"three", "four", "five"}, "records should be filtered by level")
+	assert.Equal(t, messagesOf(app.Query(DEBUG, []string{"db"}, 0)), []string{"two", "three", "five"}, "records should be filtered by tag")
+	assert.Equal(t, messagesOf(app.Query(DEBUG, []string{"db", "slow"}, 0)), []string{"three"}, "records need all of the tags")
+	assert.Equal(t, messagesOf(app.Query(DEBUG, nil, 2)), []string{"four", "five"}, "the limit keeps the newest records")
+
+	app.Query(DEBUG, nil, 0)[0].Message = "changed"
+	assert.Equal(t, messagesOf(app.Query(DEBUG, nil, 0))[0], "two", "queries return copies")
+}
+
+func TestRingAppenderPartial(t *testing.T) {
+	app := NewRingAppender(10)
+	app.SetLevel(INFO)
+
+	app.Log(NewLogRecord(nil, DEBUG, nil, "one", timestamp(), timestamp()))
+	app.Log(NewLogRecord(nil, INFO, nil, "two", timestamp(), timestamp()))
+
+	assert.Equal(t, messagesOf(app.Query(DEBUG, nil, 0)), []string{"two"}, "only records that pass the level are kept")
+}
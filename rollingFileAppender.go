@@ -2,9 +2,15 @@ package logging
 
 import (
 	"bufio"
+	"compress/gzip"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -14,12 +20,21 @@ A RollingFile appender will log to a file specified by prefix, which can contain
 concatenate the prefix and suffix using the following format "prefix.#.suffix" where # is the log file number. The current file will be "prefix.suffix".
 Note, the . between the elements, the prefix and suffix should not include these.
 
-Files can be rolled on size or manually by calling Roll().
+Files can be rolled on size, on age with SetRollInterval, or manually by calling Roll().
+
+Rolled files can be compressed with SetCompress, which gzips prefix.1.suffix to prefix.1.suffix.gz as part of the roll,
+and SetMaxTotalBytes removes the oldest rolled files once they add up to more than a limit, on top of the max files.
+SetSymlink keeps a symbolic link pointing at the current file, for tools that follow a fixed path.
+
+The file numbers are not padded by default, so prefix.10.suffix sorts before prefix.2.suffix. SetIndexWidth
+zero pads the numbers, like prefix.001.suffix, so that sorting the names matches the order of the files.
 
 The maxFiles must be at least 1
 MaxFileSize must be at least 1024 - and is measured in bytes, if the max files is 1 the max file size is ignored
 
 The actual file size will exceed maxFileSize, because the roller will not roll until a log message pushes the file past the size.
+
+The directory containing the prefix is created, if necessary, the first time the appender creates a file.
 */
 type RollingFileAppender struct {
 	BaseLogAppender
@@ -27,12 +42,87 @@ type RollingFileAppender struct {
 	suffix        string
 	maxFileSize   int64
 	maxFiles      int16
+	fileMode      os.FileMode
+	indexWidth    int
+	onRoll        func(oldPath string, newPath string)
+	rollInterval  time.Duration
+	rolledAt      time.Time
+	compress      bool
+	maxTotalBytes int64
+	symlink       string
+	linkReported  bool
 	firstTime     bool
 	currentFile   *os.File
 	currentWriter *bufio.Writer
 	mutex         *sync.RWMutex
 }
 
+//FileAppenderConfig collects the settings for a rolling file appender in one place, zero
+//values are replaced with the defaults described on each field.
+type FileAppenderConfig struct {
+	//Prefix is the path and base name for the log files, it is required
+	Prefix string
+	//Suffix is the file extension, without the ".", the default is "log"
+	Suffix string
+	//MaxFileSize is the size in bytes that triggers a roll, the default is 10MB, or no limit if RollInterval
+	//is set, the minimum is 1024
+	MaxFileSize int64
+	//RollInterval rolls the current file once it is this old, the default is to only roll on size
+	RollInterval time.Duration
+	//Compress gzips rolled files, the default is no compression
+	Compress bool
+	//MaxTotalBytes removes the oldest rolled files while they add up to more than this, the default is no limit
+	MaxTotalBytes int64
+	//Symlink is the path of a symbolic link kept pointing at the current file, the default is no link
+	Symlink string
+	//MaxFiles is the number of files to keep, including the current one, the default is 5
+	MaxFiles int16
+	//FileMode is used when log files are created, the default is 0644
+	FileMode os.FileMode
+	//IndexWidth zero pads the numbers of rolled files to this many digits, the default is no padding
+	IndexWidth int
+}
+
+//DefaultMaxFileSize is the MaxFileSize used by NewFileAppender when none is configured
+const DefaultMaxFileSize int64 = 10 * 1024 * 1024
+
+//DefaultMaxFiles is the MaxFiles used by NewFileAppender when none is configured
+const DefaultMaxFiles int16 = 5
+
+//NewFileAppender creates a rolling file appender from a config
+func NewFileAppender(config FileAppenderConfig) *RollingFileAppender {
+
+	if config.Suffix == "" {
+		config.Suffix = "log"
+	}
+
+	if config.MaxFileSize == 0 {
+		if config.RollInterval > 0 {
+			config.MaxFileSize = math.MaxInt64
+		} else {
+			config.MaxFileSize = DefaultMaxFileSize
+		}
+	}
+
+	if config.MaxFiles == 0 {
+		config.MaxFiles = DefaultMaxFiles
+	}
+
+	appender := NewRollingFileAppender(config.Prefix, config.Suffix, config.MaxFileSize, config.MaxFiles)
+
+	if config.FileMode != 0 {
+		appender.fileMode = config.FileMode
+	}
+
+	appender.indexWidth = config.IndexWidth
+	appender.rollInterval = config.RollInterval
+	appender.compress = config.Compress
+	appender.maxTotalBytes = config.MaxTotalBytes
+	appender.symlink = config.Symlink
+
+	return appender
+}
+
 //NewRollingFileAppender is used to create a rolling file appender
 func NewRollingFileAppender(prefix string, suffix string, maxFileSize int64, maxFiles int16) *RollingFileAppender {
 
@@ -50,12 +140,83 @@ func NewRollingFileAppender(prefix string, suffix string, maxFileSize int64, max
 	appender.prefix = prefix
 	appender.suffix = suffix
 	appender.maxFiles = maxFiles
+	appender.fileMode = 0644
 	appender.firstTime = true
 
 	appender.mutex = new(sync.RWMutex)
 	return appender
 }
 
+//SetFileMode sets the permissions used when the appender creates a log file, the default is 0644.
+//The mode is passed to the operating system when the file is created, so it is subject to the
+//process umask, files that already exist keep their current permissions.
+func (appender *RollingFileAppender) SetFileMode(mode os.FileMode) {
+	appender.mutex.Lock()
+	appender.fileMode = mode
+	appender.mutex.Unlock()
+}
+
+//SetIndexWidth zero pads the numbers in rolled file names to the width, so a width of 3 names the
+//first rolled file prefix.001.suffix. A width of 0, the default, doesn't pad. Files that were rolled
+//with a different width are still found and renamed to the new width the next time the appender rolls.
+func (appender *RollingFileAppender) SetIndexWidth(width int) {
+	appender.mutex.Lock()
+	appender.indexWidth = width
+	appender.mutex.Unlock()
+}
+
+//OnRoll registers a callback that is called after each roll that moved the current file, with the
+//current file's path and the path it was moved to. The callback is called after the appender's lock
+//is released, on the go routine that rolled, which is usually the logging go routine. It should return
+//quickly and can start its own go routine for slow work like uploading the file. Pass nil to remove it.
+func (appender *RollingFileAppender) OnRoll(callback func(oldPath string, newPath string)) {
+	appender.mutex.Lock()
+	appender.onRoll = callback
+	appender.mutex.Unlock()
+}
+
+//SetRollInterval rolls the current file once it has been written for the interval, as well as when it
+//reaches the max file size, 0, the default, only rolls on size. The age is measured from the last roll,
+//and like the size it is checked when a record is logged.
+func (appender *RollingFileAppender) SetRollInterval(interval time.Duration) {
+	appender.mutex.Lock()
+	appender.rollInterval = interval
+	appender.mutex.Unlock()
+}
+
+//SetCompress gzips the file that was current each time the appender rolls, so rolled files are named
+//prefix.#.suffix.gz. The compression happens during the roll, on the go routine that rolled. Files that
+//were rolled before it was turned on or off keep their format, and are still numbered and removed.
+func (appender *RollingFileAppender) SetCompress(compress bool) {
+	appender.mutex.Lock()
+	appender.compress = compress
+	appender.mutex.Unlock()
+}
+
+//SetMaxTotalBytes limits the total size of the rolled files, after each roll the oldest are removed until
+//the rest fit, the current file is not counted. 0, the default, only limits the number of files.
+func (appender *RollingFileAppender) SetMaxTotalBytes(max int64) {
+	appender.mutex.Lock()
+	appender.maxTotalBytes = max
+	appender.mutex.Unlock()
+}
+
+//SetSymlink keeps a symbolic link at the path pointing to the current file, it is created or replaced
+//when the appender opens the current file. An empty path, the default, doesn't create a link. If the link
+//can't be created, for example on platforms that don't allow the process to create links, the error is
+//sent to the logging error channel once and the appender keeps writing to the file.
+func (appender *RollingFileAppender) SetSymlink(path string) {
+	appender.mutex.Lock()
+	appender.symlink = path
+	appender.linkReported = false
+	appender.mutex.Unlock()
+}
+
+//rolledFileName should be called inside the lock
+func (appender *RollingFileAppender) rolledFileName(i int16) string {
+	return fmt.Sprintf("%v.%0*d.%v", appender.prefix, appender.indexWidth, i, appender.suffix)
+}
+
 //currentFileName should be called inside the lock
 func (appender *RollingFileAppender) currentFileName() string {
 	return fmt.Sprintf("%v.%v", appender.prefix, appender.suffix)
@@ -69,14 +230,20 @@ func (appender *RollingFileAppender) open() error {
 		return nil
 	}
 
-	f, err := os.OpenFile(appender.currentFileName(), os.O_APPEND|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(appender.currentFileName(), os.O_APPEND|os.O_WRONLY, appender.fileMode)
 
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
 
-		f, err = os.Create(appender.currentFileName())
+		err = os.MkdirAll(filepath.Dir(appender.prefix), 0755)
+
+		if err != nil {
+			return err
+		}
+
+		f, err = os.OpenFile(appender.currentFileName(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, appender.fileMode)
 
 		if err != nil {
 			return err
@@ -86,9 +253,38 @@ func (appender *RollingFileAppender) open() error {
 	appender.currentFile = f
 	appender.currentWriter = bufio.NewWriter(appender.currentFile)
 
+	if err := appender.link(); err != nil && !appender.linkReported {
+		//open can run on the logging go routine, which holds the logging lock
+		appender.linkReported = true
+		go reportAppenderError(appender, fmt.Errorf("unable to link %v to the current file, %v", appender.symlink, err))
+	}
+
 	return nil
 }
 
+//link should be called inside the lock, it points the symlink at the current file
+func (appender *RollingFileAppender) link() error {
+	if appender.symlink == "" {
+		return nil
+	}
+
+	target, err := filepath.Abs(appender.currentFileName())
+
+	if err != nil {
+		return err
+	}
+
+	if existing, err := os.Readlink(appender.symlink); err == nil && existing == target {
+		return nil
+	}
+
+	if err := os.Remove(appender.symlink); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(target, appender.symlink)
+}
+
 //Close closes the current file after flushing any buffered data
 func (appender *RollingFileAppender) Close() error {
 	appender.mutex.Lock()
@@ -109,6 +305,24 @@ func (appender *RollingFileAppender) Close() error {
 	return err
 }
 
+//Sync flushes the buffered data and syncs the current file to disk
+func (appender *RollingFileAppender) Sync() error {
+	appender.mutex.Lock()
+	defer appender.mutex.Unlock()
+
+	if appender.currentWriter != nil {
+		if err := appender.currentWriter.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if appender.currentFile != nil {
+		return appender.currentFile.Sync()
+	}
+
+	return nil
+}
+
 //needsRoll should be called inside the lock
 func (appender *RollingFileAppender) needsRoll() bool {
 
@@ -134,7 +348,7 @@ func (appender *RollingFileAppender) needsRoll() bool {
 		return true
 	}
 
-	return false
+	return appender.rollInterval > 0 && time.Since(appender.rolledAt) >= appender.rollInterval
 }
 
 //Roll moves the file to the next number, up to the max files.
@@ -142,9 +356,27 @@ func (appender *RollingFileAppender) Roll() error {
 	appender.Close()
 
 	appender.mutex.Lock()
-	defer appender.mutex.Unlock()
+	moved, err := appender.roll()
+	callback := appender.onRoll
+	oldPath := appender.currentFileName()
+	newPath := appender.rolledFileName(1)
+	if appender.compress {
+		newPath += ".gz"
+	}
+	appender.mutex.Unlock()
+
+	if err == nil && moved && callback != nil {
+		callback(oldPath, newPath)
+	}
+
+	return err
+}
 
+//roll should be called inside the lock, it returns true if the current file was moved
+func (appender *RollingFileAppender) roll() (bool, error) {
 	appender.firstTime = false
+	appender.rolledAt = time.Now()
+	moved := false
 
 	for i := appender.maxFiles - 2; i >= 0; i-- {
 
@@ -152,42 +384,192 @@ func (appender *RollingFileAppender) Roll() error {
 
 		if i == 0 {
 			fileName = appender.currentFileName()
+			_, err := os.Stat(fileName)
+
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return false, err
+			}
 		} else {
-			fileName = fmt.Sprintf("%v.%d.%v", appender.prefix, i, appender.suffix)
-		}
+			var err error
+			fileName, _, err = appender.existingRolledFile(i)
 
-		_, err := os.Stat(fileName)
+			if err != nil {
+				return false, err
+			}
 
-		if err != nil {
-			if os.IsNotExist(err) {
+			if fileName == "" {
 				continue //do'nt have this file yet
-			} else {
-				return err
 			}
 		}
 
-		//we work backward so the only time the next file should exist is for the truly last file
-		nextFileName := fmt.Sprintf("%v.%d.%v", appender.prefix, i+1, appender.suffix)
-		_, err = os.Stat(nextFileName)
+		//we work backward so the only time the next file should exist is for the truly last file,
+		//which may have been rolled with or without compression
+		if err := appender.removeRolledFile(i + 1); err != nil {
+			return false, err
+		}
 
-		if err != nil && !os.IsNotExist(err) {
-			err = os.Remove(nextFileName)
+		nextFileName := appender.rolledFileName(i + 1)
 
-			if err != nil {
-				return err
-			}
+		if strings.HasSuffix(fileName, ".gz") {
+			nextFileName += ".gz"
+		}
+
+		if err := os.Rename(fileName, nextFileName); err != nil {
+			return false, err
+		}
+
+		moved = moved || i == 0
+	}
+
+	if moved && appender.compress {
+		if err := gzipFile(appender.rolledFileName(1), appender.fileMode); err != nil {
+			return moved, err
+		}
+	}
+
+	return moved, appender.trimRolledFiles()
+}
+
+//rolledFileCandidates should be called inside the lock, it returns the names a rolled file can have,
+//padded or from before the width was set, and compressed or not
+func (appender *RollingFileAppender) rolledFileCandidates(i int16) []string {
+	names := []string{appender.rolledFileName(i)}
+
+	if appender.indexWidth > 0 {
+		names = append(names, fmt.Sprintf("%v.%d.%v", appender.prefix, i, appender.suffix))
+	}
+
+	candidates := make([]string, 0, 2*len(names))
+
+	for _, name := range names {
+		candidates = append(candidates, name, name+".gz")
+	}
+
+	return candidates
+}
+
+//existingRolledFile should be called inside the lock, it returns the name and size of the rolled file
+//with the number, or an empty name if there isn't one
+func (appender *RollingFileAppender) existingRolledFile(i int16) (string, int64, error) {
+	for _, name := range appender.rolledFileCandidates(i) {
+		info, err := os.Stat(name)
+
+		if err == nil {
+			return name, info.Size(), nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", 0, err
 		}
+	}
 
-		err = os.Rename(fileName, nextFileName)
+	return "", 0, nil
+}
+
+//removeRolledFile should be called inside the lock, it removes every file with the number
+func (appender *RollingFileAppender) removeRolledFile(i int16) error {
+	for _, name := range appender.rolledFileCandidates(i) {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//trimRolledFiles should be called inside the lock, it removes the oldest rolled files while they are
+//over the max total bytes
+func (appender *RollingFileAppender) trimRolledFiles() error {
+	if appender.maxTotalBytes <= 0 {
+		return nil
+	}
+
+	sizes := make([]int64, appender.maxFiles)
+	var total int64
+
+	for i := int16(1); i < appender.maxFiles; i++ {
+		_, size, err := appender.existingRolledFile(i)
 
 		if err != nil {
 			return err
 		}
+
+		sizes[i] = size
+		total += size
+	}
+
+	for i := appender.maxFiles - 1; i >= 1 && total > appender.maxTotalBytes; i-- {
+		if sizes[i] == 0 {
+			continue
+		}
+
+		if err := appender.removeRolledFile(i); err != nil {
+			return err
+		}
+
+		total -= sizes[i]
 	}
 
 	return nil
 }
 
+//gzipFile compresses the file to the same name with .gz and removes the original
+func gzipFile(path string, mode os.FileMode) error {
+	in, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
+
+//Verify prepares the current file the same way the first call to Log would, rolling if necessary,
+//so that problems like a missing permission are reported before any records are logged.
+func (appender *RollingFileAppender) Verify() error {
+	appender.mutex.RLock()
+	roll := appender.needsRoll()
+	appender.mutex.RUnlock()
+
+	if roll {
+		err := appender.Roll()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return appender.open()
+}
+
 //Log a record to the current file
 func (appender *RollingFileAppender) Log(record *LogRecord) error {
 
@@ -1,11 +1,16 @@
 package logging
 
 import (
+	"compress/gzip"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
 	"os"
 	"path"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestRollingAppender(t *testing.T) {
@@ -91,3 +96,334 @@ func TestRollingAppenderNew(t *testing.T) {
 	assert.Equal(t, app.maxFileSize, 1024, "max filesize defaults to 1024")
 	assert.Equal(t, app.currentFileName(), fmt.Sprintf("%s.%s", filepath, "log"), "current file name is always prefix.suffix")
 }
+
+func TestRollingAppenderCreatesDirectory(t *testing.T) {
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("rollingtest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "nested", "appendtest")
+	app := NewRollingFileAppender(filepath, "log", int64(2048), 2)
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	ClearAppenders()
+	AddAppender(app)
+
+	SetDefaultLogLevel(INFO)
+	Warn("1")
+
+	WaitForIncoming()
+	ClearAppenders() //will close the rolling log appender
+
+	info, err := os.Stat(fmt.Sprintf("%s.log", filepath))
+	assert.Nil(t, err, "Stat should be able to find the log file in the new directory")
+	assert.Equal(t, info.Size(), 2, "new file should have the message and a new line")
+}
+
+func TestRollingAppenderFileMode(t *testing.T) {
+
+	filepath := path.Join(os.TempDir(), "modetest")
+	pathOne := fmt.Sprintf("%s.log", filepath)
+	os.Remove(pathOne)
+	defer os.Remove(pathOne)
+
+	app := NewRollingFileAppender(filepath, "log", int64(2048), 1)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	app.SetFileMode(0600)
+
+	ClearAppenders()
+	AddAppender(app)
+
+	SetDefaultLogLevel(INFO)
+	Warn("1")
+
+	WaitForIncoming()
+	ClearAppenders() //will close the rolling log appender
+
+	info, err := os.Stat(pathOne)
+	assert.Nil(t, err, "Stat should be able to find the log file")
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600), "file should be created with the configured mode")
+}
+
+func TestRollingAppenderVerify(t *testing.T) {
+
+	blocker := path.Join(os.TempDir(), "verifytest-blocker")
+	f, _ := os.Create(blocker)
+	f.Close()
+	defer os.Remove(blocker)
+
+	good := path.Join(os.TempDir(), "verifytest")
+	goodApp := NewRollingFileAppender(good, "log", int64(2048), 2)
+	badApp := NewRollingFileAppender(path.Join(blocker, "sub", "verifytest"), "log", int64(2048), 2)
+
+	ClearAppenders()
+	AddAppender(goodApp)
+	AddAppender(NewMemoryAppender())
+	AddAppender(badApp)
+
+	errs := VerifyAppenders()
+	ClearAppenders() //will close the rolling log appenders
+
+	assert.Equal(t, len(errs), 1, "only the appender under a regular file should fail")
+
+	_, err := os.Stat(fmt.Sprintf("%s.log", good))
+	assert.Nil(t, err, "verify should create the log file")
+}
+
+func TestNewFileAppender(t *testing.T) {
+
+	filepath := path.Join(os.TempDir(), "appendtest")
+	app := NewFileAppender(FileAppenderConfig{Prefix: filepath})
+
+	assert.Equal(t, app.maxFiles, DefaultMaxFiles, "max files has a default")
+	assert.Equal(t, app.maxFileSize, DefaultMaxFileSize, "max file size has a default")
+	assert.Equal(t, app.fileMode, os.FileMode(0644), "file mode has a default")
+	assert.Equal(t, app.currentFileName(), fmt.Sprintf("%s.%s", filepath, "log"), "suffix defaults to log")
+
+	app = NewFileAppender(FileAppenderConfig{Prefix: filepath, Suffix: "txt", MaxFileSize: 100, MaxFiles: 2, FileMode: 0600})
+
+	assert.Equal(t, app.maxFiles, 2, "max files can be configured")
+	assert.Equal(t, app.maxFileSize, 1024, "max file size has a minimum")
+	assert.Equal(t, app.fileMode, os.FileMode(0600), "file mode can be configured")
+	assert.Equal(t, app.currentFileName(), fmt.Sprintf("%s.%s", filepath, "txt"), "suffix can be configured")
+
+	app = NewFileAppender(FileAppenderConfig{Prefix: filepath, IndexWidth: 3})
+
+	assert.Equal(t, app.rolledFileName(1), fmt.Sprintf("%s.001.log", filepath), "index width can be configured")
+
+	app = NewFileAppender(FileAppenderConfig{Prefix: filepath, RollInterval: time.Hour, Compress: true, MaxTotalBytes: 4096, Symlink: "current"})
+
+	assert.Equal(t, app.maxFileSize, int64(math.MaxInt64), "time rotation doesn't limit the size by default")
+	assert.Equal(t, app.rollInterval, time.Hour, "roll interval can be configured")
+	assert.True(t, app.compress, "compression can be configured")
+	assert.Equal(t, app.maxTotalBytes, 4096, "total bytes can be configured")
+	assert.Equal(t, app.symlink, "current", "symlink can be configured")
+}
+
+func TestRollingAppenderIndexWidth(t *testing.T) {
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("widthtest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	app := NewRollingFileAppender(filepath, "log", int64(2048), 4)
+	app.SetIndexWidth(2)
+
+	for _, name := range []string{"appendtest.log", "appendtest.1.log"} {
+		f, _ := os.Create(path.Join(dir, name))
+		f.Close()
+	}
+
+	err := app.Roll()
+	assert.Nil(t, err, "roll should succeed")
+
+	_, err = os.Stat(fmt.Sprintf("%s.01.log", filepath))
+	assert.Nil(t, err, "the current file should be rolled to a padded name")
+
+	_, err = os.Stat(fmt.Sprintf("%s.02.log", filepath))
+	assert.Nil(t, err, "an unpadded file should be rolled to the next padded name")
+
+	_, err = os.Stat(fmt.Sprintf("%s.1.log", filepath))
+	assert.True(t, os.IsNotExist(err), "the unpadded file should be gone")
+}
+
+func TestRollingAppenderOnRoll(t *testing.T) {
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("onrolltest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	app := NewRollingFileAppender(filepath, "log", int64(2048), 3)
+
+	var rolls [][]string
+	app.OnRoll(func(oldPath string, newPath string) {
+		rolls = append(rolls, []string{oldPath, newPath})
+	})
+
+	assert.Nil(t, app.Roll(), "roll should succeed")
+	assert.Equal(t, len(rolls), 0, "the callback isn't called when there is no current file")
+
+	f, _ := os.Create(fmt.Sprintf("%s.log", filepath))
+	f.Close()
+
+	assert.Nil(t, app.Roll(), "roll should succeed")
+	assert.Equal(t, rolls, [][]string{{fmt.Sprintf("%s.log", filepath), fmt.Sprintf("%s.1.log", filepath)}}, "the callback gets the paths")
+}
+
+func TestRollingAppenderSync(t *testing.T) {
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("synctest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	app := NewRollingFileAppender(filepath, "log", int64(2048), 2)
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	assert.Nil(t, app.Sync(), "syncing before a file is open should do nothing")
+
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "1", time.Now(), time.Now())))
+	assert.Nil(t, app.Sync(), "syncing the current file should succeed")
+	app.Close()
+
+	info, err := os.Stat(fmt.Sprintf("%s.log", filepath))
+	assert.Nil(t, err, "Stat should be able to find the log file")
+	assert.Equal(t, info.Size(), 2, "file should have the message and a new line")
+}
+
+func TestRollingAppenderCompress(t *testing.T) {
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("compresstest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	app := NewFileAppender(FileAppenderConfig{Prefix: filepath, MaxFiles: 3, Compress: true})
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	var rolled string
+	app.OnRoll(func(oldPath string, newPath string) {
+		rolled = newPath
+	})
+
+	for _, message := range []string{"one", "two", "three"} {
+		assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, message, time.Now(), time.Now())))
+		assert.Nil(t, app.Roll(), "roll should succeed")
+	}
+	app.Close()
+
+	assert.Equal(t, rolled, fmt.Sprintf("%s.1.log.gz", filepath), "the callback gets the compressed path")
+
+	_, err := os.Stat(fmt.Sprintf("%s.1.log", filepath))
+	assert.True(t, os.IsNotExist(err), "the uncompressed file should be removed")
+
+	for i, message := range map[int]string{1: "three\n", 2: "two\n"} {
+		f, err := os.Open(fmt.Sprintf("%s.%d.log.gz", filepath, i))
+		assert.Nil(t, err, "rolled files should be compressed")
+		reader, err := gzip.NewReader(f)
+		assert.Nil(t, err, "rolled files should be gzipped")
+		contents, _ := ioutil.ReadAll(reader)
+		f.Close()
+		assert.Equal(t, string(contents), message, "compressed files keep their contents and move along")
+	}
+
+	_, err = os.Stat(fmt.Sprintf("%s.3.log.gz", filepath))
+	assert.True(t, os.IsNotExist(err), "compressed files still count towards the max files")
+}
+
+func TestRollingAppenderMaxTotalBytes(t *testing.T) {
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("totaltest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	app := NewFileAppender(FileAppenderConfig{Prefix: filepath, MaxFiles: 5, MaxTotalBytes: 2500})
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, ioutil.WriteFile(fmt.Sprintf("%s.log", filepath), make([]byte, 1000), 0644))
+		assert.Nil(t, app.Roll(), "roll should succeed")
+	}
+
+	for i, exists := range []bool{true, true, false, false} {
+		_, err := os.Stat(fmt.Sprintf("%s.%d.log", filepath, i+1))
+		assert.Equal(t, err == nil, exists, "the oldest files over the total should be removed")
+	}
+}
+
+func TestRollingAppenderRollInterval(t *testing.T) {
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("intervaltest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	app := NewFileAppender(FileAppenderConfig{Prefix: filepath, RollInterval: 20 * time.Millisecond})
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "one", time.Now(), time.Now())))
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "two", time.Now(), time.Now())))
+
+	_, err := os.Stat(fmt.Sprintf("%s.1.log", filepath))
+	assert.True(t, os.IsNotExist(err), "the file shouldn't roll before the interval")
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "three", time.Now(), time.Now())))
+	app.Close()
+
+	contents, err := ioutil.ReadFile(fmt.Sprintf("%s.1.log", filepath))
+	assert.Nil(t, err, "the file should roll after the interval")
+	assert.Equal(t, string(contents), "one\ntwo\n")
+
+	contents, _ = ioutil.ReadFile(fmt.Sprintf("%s.log", filepath))
+	assert.Equal(t, string(contents), "three\n", "the current file starts after the roll")
+}
+
+func TestRollingAppenderSymlink(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("creating links needs extra privileges on windows")
+	}
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("symlinktest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	link := path.Join(dir, "current.log")
+	assert.Nil(t, os.Symlink(path.Join(dir, "elsewhere"), link))
+
+	app := NewFileAppender(FileAppenderConfig{Prefix: filepath, Symlink: link})
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "one", time.Now(), time.Now())))
+	assert.Nil(t, app.Roll())
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "two", time.Now(), time.Now())))
+	app.Close()
+
+	contents, err := ioutil.ReadFile(link)
+	assert.Nil(t, err, "the link should point at a file")
+	assert.Equal(t, string(contents), "two\n", "the link should follow the current file")
+}
+
+func TestRollingAppenderSymlinkError(t *testing.T) {
+	errors := make(chan error, 10)
+	CaptureLoggingErrors(errors)
+	defer CaptureLoggingErrors(nil)
+
+	dir := path.Join(os.TempDir(), fmt.Sprintf("symlinkerrortest-%d", os.Getpid()))
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	filepath := path.Join(dir, "appendtest")
+	link := path.Join(dir, "missing", "current.log")
+
+	app := NewFileAppender(FileAppenderConfig{Prefix: filepath, Symlink: link})
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "one", time.Now(), time.Now())), "a missing link shouldn't stop logging")
+	assert.Nil(t, app.Roll())
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "two", time.Now(), time.Now())))
+	app.Close()
+
+	err := <-errors
+	assert.Contains(t, err.Error(), link, "the link error should be sent to the error channel")
+
+	select {
+	case err = <-errors:
+		t.Errorf("the link error should only be reported once, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	contents, err := ioutil.ReadFile(filepath + ".log")
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "two\n", "records should still be written to the current file")
+}
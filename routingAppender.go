@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"io"
+)
+
+/*
+RoutingAppender writes each record to the writer configured for the record's level.
+
+Records at a level without a route are written to the fallback writer, or dropped if the fallback is nil.
+The appender's own level is checked before routing, like other appenders. Several levels can share a writer,
+SetRouteRange is a shortcut for routing a range of levels to the same place.
+*/
+type RoutingAppender struct {
+	BaseLogAppender
+	routes   map[LogLevel]io.Writer
+	fallback io.Writer
+}
+
+//NewRoutingAppender creates a routing appender, the routes are copied so the map can be reused
+func NewRoutingAppender(routes map[LogLevel]io.Writer, fallback io.Writer) *RoutingAppender {
+	appender := new(RoutingAppender)
+	appender.routes = make(map[LogLevel]io.Writer, len(routes))
+	appender.fallback = fallback
+
+	for level, writer := range routes {
+		appender.routes[level] = writer
+	}
+
+	return appender
+}
+
+//SetRoute sends records at the level to the writer, a nil writer removes the route
+func (appender *RoutingAppender) SetRoute(level LogLevel, writer io.Writer) {
+	appender.m.Lock()
+	appender.setRoute(level, writer)
+	appender.m.Unlock()
+}
+
+//SetRouteRange sends records with levels from min to max, inclusive, to the writer
+func (appender *RoutingAppender) SetRouteRange(min LogLevel, max LogLevel, writer io.Writer) {
+	appender.m.Lock()
+	for level := int(min); level <= int(max); level++ {
+		appender.setRoute(LogLevel(level), writer)
+	}
+	appender.m.Unlock()
+}
+
+//should be called inside the lock
+func (appender *RoutingAppender) setRoute(level LogLevel, writer io.Writer) {
+	if writer == nil {
+		delete(appender.routes, level)
+	} else {
+		appender.routes[level] = writer
+	}
+}
+
+//Log checks the record's level, then writes the formatted record followed by "\n"
+//to the writer for its level
+func (appender *RoutingAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if !appender.checkLevel(record.Level) {
+		return nil
+	}
+
+	writer, ok := appender.routes[record.Level]
+
+	if !ok {
+		writer = appender.fallback
+	}
+
+	if writer == nil {
+		return nil
+	}
+
+	_, err := writer.Write([]byte(appender.format(record) + "\n"))
+	return err
+}
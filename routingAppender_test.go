@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestRoutingAppender(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(DEBUG)
+
+	errors := bytes.NewBuffer(nil)
+	info := bytes.NewBuffer(nil)
+	fallback := bytes.NewBuffer(nil)
+
+	app := NewRoutingAppender(map[LogLevel]io.Writer{ERROR: errors}, fallback)
+	app.SetRouteRange(INFO, WARN, info)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	AddAppender(app)
+
+	Error("one")
+	Warn("two")
+	Info("three")
+	Debug("four")
+
+	WaitForIncoming()
+	assert.Equal(t, errors.String(), "one\n", "errors should be routed to their writer")
+	assert.Equal(t, info.String(), "two\nthree\n", "a range of levels should share a writer")
+	assert.Equal(t, fallback.String(), "four\n", "levels without a route should use the fallback")
+}
+
+func TestRoutingAppenderWithoutFallback(t *testing.T) {
+	ClearAppenders()
+	SetDefaultLogLevel(DEBUG)
+
+	info := bytes.NewBuffer(nil)
+
+	app := NewRoutingAppender(nil, nil)
+	app.SetRoute(INFO, info)
+	app.SetRoute(DEBUG, info)
+	app.SetRoute(DEBUG, nil)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	AddAppender(app)
+
+	Error("one")
+	Info("two")
+	Debug("three")
+
+	WaitForIncoming()
+	assert.Equal(t, info.String(), "two\n", "levels without a route should be dropped")
+}
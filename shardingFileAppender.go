@@ -0,0 +1,223 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+ShardingFileAppender writes records to a file per value of a shard tag, for example a file per tenant.
+
+With a tag key of "tenant", a record with the tag "tenant:42" is written to dir/tenant-42.log, and records
+without a tenant tag are written to dir/tenant.log. Characters in the value other than letters, digits,
+".", "-" and "_" are replaced with "_" so that a value can't name a file outside the directory. If a record
+has several shard tags the first is used.
+
+Files are opened the first time they are needed, and the directory is created if necessary. At most
+DefaultShardMaxOpenFiles files are open at once, SetMaxOpenFiles changes the limit, and opening another
+closes the least recently written one. Files that haven't been written for the idle timeout are closed
+too, which is checked when a record is logged. A timeout of 0 only closes files for the limit.
+Close, which ClearAppenders calls, closes every open file.
+*/
+type ShardingFileAppender struct {
+	BaseLogAppender
+	dir         string
+	tagKey      string
+	idleTimeout time.Duration
+	fileMode    os.FileMode
+	maxOpen     int
+	files       map[string]*shardFile
+	lastSweep   time.Time
+	uses        uint64
+}
+
+type shardFile struct {
+	file     *os.File
+	lastUsed time.Time
+	use      uint64
+}
+
+//DefaultShardMaxOpenFiles is the most files a ShardingFileAppender keeps open by default
+const DefaultShardMaxOpenFiles = 64
+
+//NewShardingFileAppender creates an appender that shards records into files in dir by the tag key
+func NewShardingFileAppender(dir string, tagKey string, idleTimeout time.Duration) *ShardingFileAppender {
+	return &ShardingFileAppender{
+		dir:         dir,
+		tagKey:      tagKey,
+		idleTimeout: idleTimeout,
+		fileMode:    0644,
+		maxOpen:     DefaultShardMaxOpenFiles,
+		files:       make(map[string]*shardFile),
+		lastSweep:   time.Now(),
+	}
+}
+
+//Log checks the record's level and writes the formatted record followed by "\n" to the record's shard file
+func (appender *ShardingFileAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if !appender.checkLevel(record.Level) {
+		return nil
+	}
+
+	now := time.Now()
+	shard, err := appender.open(appender.shardPath(record.Tags), now)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = shard.file.WriteString(appender.format(record) + "\n")
+
+	if appender.idleTimeout > 0 && now.Sub(appender.lastSweep) >= appender.idleTimeout {
+		appender.closeIdle(now)
+	}
+
+	return err
+}
+
+//SetMaxOpenFiles limits the number of shard files that are open at once, when another file is needed the
+//least recently written file is closed, it is reopened if a record is logged to it again. The limit is at least 1.
+func (appender *ShardingFileAppender) SetMaxOpenFiles(max int) {
+	if max < 1 {
+		max = 1
+	}
+
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	appender.maxOpen = max
+
+	for len(appender.files) > appender.maxOpen {
+		appender.closeLeastRecent()
+	}
+}
+
+//OpenFiles returns the number of shard files that are open
+func (appender *ShardingFileAppender) OpenFiles() int {
+	appender.m.RLock()
+	defer appender.m.RUnlock()
+
+	return len(appender.files)
+}
+
+//Sync calls Sync on every open file, and returns the first error
+func (appender *ShardingFileAppender) Sync() error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	var firstErr error
+
+	for _, shard := range appender.files {
+		if err := shard.file.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+//Close closes every open file, and returns the first error, logging again reopens them
+func (appender *ShardingFileAppender) Close() error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	var firstErr error
+
+	for path, shard := range appender.files {
+		if err := shard.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(appender.files, path)
+	}
+
+	return firstErr
+}
+
+//shardPath returns the file for the first shard tag, or the default file
+func (appender *ShardingFileAppender) shardPath(tags []string) string {
+	prefix := appender.tagKey + ":"
+
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) && len(tag) > len(prefix) {
+			return filepath.Join(appender.dir, appender.tagKey+"-"+shardName(tag[len(prefix):])+".log")
+		}
+	}
+
+	return filepath.Join(appender.dir, appender.tagKey+".log")
+}
+
+//shardName replaces the characters that aren't safe in a file name
+func shardName(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
+
+//should be called inside the lock
+func (appender *ShardingFileAppender) open(path string, now time.Time) (*shardFile, error) {
+	shard, ok := appender.files[path]
+
+	if !ok {
+		for len(appender.files) >= appender.maxOpen {
+			appender.closeLeastRecent()
+		}
+
+		if err := os.MkdirAll(appender.dir, 0755); err != nil {
+			return nil, fmt.Errorf("unable to create the log directory %s: %v", appender.dir, err)
+		}
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, appender.fileMode)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shard = &shardFile{file: file}
+		appender.files[path] = shard
+	}
+
+	appender.uses++
+	shard.use = appender.uses
+	shard.lastUsed = now
+	return shard, nil
+}
+
+//should be called inside the lock, errors are ignored like closing idle files
+func (appender *ShardingFileAppender) closeLeastRecent() {
+	var oldestPath string
+	var oldest *shardFile
+
+	for path, shard := range appender.files {
+		if oldest == nil || shard.use < oldest.use {
+			oldestPath, oldest = path, shard
+		}
+	}
+
+	if oldest != nil {
+		oldest.file.Close()
+		delete(appender.files, oldestPath)
+	}
+}
+
+//should be called inside the lock, errors closing idle files are ignored because nothing was lost
+func (appender *ShardingFileAppender) closeIdle(now time.Time) {
+	appender.lastSweep = now
+
+	for path, shard := range appender.files {
+		if now.Sub(shard.lastUsed) >= appender.idleTimeout {
+			shard.file.Close()
+			delete(appender.files, path)
+		}
+	}
+}
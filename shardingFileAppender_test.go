@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestShardingFileAppender(t *testing.T) {
+	dir := path.Join(os.TempDir(), "shardtest")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	app := NewShardingFileAppender(dir, "tenant", 0)
+	app.SetFormatter(GetFormatter(MINIMAL))
+
+	when := time.Now()
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, []string{"http", "tenant:42"}, "one", when, when)))
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, []string{"tenant:7"}, "two", when, when)))
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, []string{"tenant:42"}, "three", when, when)))
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, nil, "untagged", when, when)))
+	assert.Nil(t, app.Log(NewLogRecord(nil, INFO, []string{"tenant:../escape"}, "unsafe", when, when)))
+	assert.Equal(t, app.OpenFiles(), 4, "a file should be open for each shard")
+
+	assert.Nil(t, app.Close())
+	assert.Equal(t, app.OpenFiles(), 0, "close should close every file")
+
+	contents, err := ioutil.ReadFile(path.Join(dir, "tenant-42.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "one\nthree\n", "records should be written to their shard")
+
+	contents, err = ioutil.ReadFile(path.Join(dir, "tenant-7.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "two\n")
+
+	contents, err = ioutil.ReadFile(path.Join(dir, "tenant.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "untagged\n", "records without the tag go to the default file")
+
+	contents, err = ioutil.ReadFile(path.Join(dir, "tenant-.._escape.log"))
+	assert.Nil(t, err, "unsafe characters should be replaced")
+	assert.Equal(t, string(contents), "unsafe\n")
+}
+
+func TestShardingFileAppenderIdle(t *testing.T) {
+	dir := path.Join(os.TempDir(), "shardidletest")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	app := NewShardingFileAppender(dir, "tenant", 10*time.Millisecond)
+	defer app.Close()
+
+	when := time.Now()
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:1"}, "one", when, when))
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:2"}, "two", when, when))
+	assert.Equal(t, app.OpenFiles(), 2)
+
+	time.Sleep(20 * time.Millisecond)
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:2"}, "three", when, when))
+	assert.Equal(t, app.OpenFiles(), 1, "idle files should be closed")
+
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:1"}, "four", when, when))
+	assert.Equal(t, app.OpenFiles(), 2, "closed files are reopened when needed")
+}
+
+func TestShardingFileAppenderMaxOpenFiles(t *testing.T) {
+	dir := path.Join(os.TempDir(), "shardmaxtest")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	app := NewShardingFileAppender(dir, "tenant", 0)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	defer app.Close()
+
+	app.SetMaxOpenFiles(2)
+
+	when := time.Now()
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:1"}, "one", when, when))
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:2"}, "two", when, when))
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:1"}, "three", when, when))
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:3"}, "four", when, when))
+	assert.Equal(t, app.OpenFiles(), 2, "the open files should be limited")
+
+	app.m.RLock()
+	_, open := app.files[path.Join(dir, "tenant-2.log")]
+	app.m.RUnlock()
+	assert.False(t, open, "the least recently written file should be closed")
+
+	app.Log(NewLogRecord(nil, INFO, []string{"tenant:2"}, "five", when, when))
+	assert.Equal(t, app.OpenFiles(), 2)
+
+	contents, err := ioutil.ReadFile(path.Join(dir, "tenant-2.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "two\nfive\n", "closed files are reopened for appending")
+
+	app.SetMaxOpenFiles(1)
+	assert.Equal(t, app.OpenFiles(), 1, "lowering the limit closes files")
+}
@@ -0,0 +1,106 @@
+package logging
+
+/*
+Config is a copy of the logging configuration taken by SnapshotConfig, so that it can be put back
+with RestoreConfig, for example after a test or after turning on debug logging for a while.
+
+The maps and slices are copies, changing the logging configuration after the snapshot doesn't change
+them, and changing them doesn't change the logging configuration until the Config is restored. Buffers,
+muted tags, verbose logging and the other package settings are not part of the snapshot.
+*/
+type Config struct {
+	//DefaultLevel is the default logger's level
+	DefaultLevel LogLevel
+	//DefaultTagLevels are the default logger's tag levels
+	DefaultTagLevels map[string]LogLevel
+	//LoggerLevels holds the level of each named logger
+	LoggerLevels map[string]LogLevel
+	//LoggerTagLevels holds the tag levels of each named logger that has them
+	LoggerTagLevels map[string]map[string]LogLevel
+	//Appenders are the global appenders
+	Appenders []LogAppender
+	//Formatter is the default formatter
+	Formatter LogFormatter
+}
+
+//SnapshotConfig copies the current logging configuration
+func SnapshotConfig() Config {
+	logMutex.RLock()
+	defer logMutex.RUnlock()
+
+	config := Config{
+		DefaultLevel:     defaultLogger.level,
+		DefaultTagLevels: copyTagLevels(defaultLogger.tagLevels),
+		LoggerLevels:     make(map[string]LogLevel, len(loggers)),
+		LoggerTagLevels:  make(map[string]map[string]LogLevel),
+		Formatter:        getDefaultFormatter(),
+	}
+
+	for name, logger := range loggers {
+		config.LoggerLevels[name] = logger.level
+
+		if logger.tagLevels != nil {
+			config.LoggerTagLevels[name] = copyTagLevels(logger.tagLevels)
+		}
+	}
+
+	current := currentAppenders()
+	config.Appenders = make([]LogAppender, len(current))
+	copy(config.Appenders, current)
+
+	return config
+}
+
+/*
+RestoreConfig puts back a configuration from SnapshotConfig in one step. Named loggers that aren't in
+the snapshot are kept, with the DEFAULT level and no tag levels. Appenders that aren't in the snapshot
+are closed if they implement ClosableAppender, like ReplaceAppenders, so restoring a snapshot taken
+before ClearAppenders brings back appenders that were already closed. Buffers are flushed, since the
+levels may have changed.
+*/
+func RestoreConfig(config Config) {
+	restored := make([]LogAppender, len(config.Appenders))
+	copy(restored, config.Appenders)
+
+	logMutex.Lock()
+	defaultLogger.level = config.DefaultLevel
+	defaultLogger.tagLevels = copyTagLevels(config.DefaultTagLevels)
+
+	for name, level := range config.LoggerLevels {
+		if _, ok := loggers[name]; !ok {
+			logger := new(LoggerImpl)
+			logger.name = name
+			logger.setBufferLengthImpl(defaultLogger.buffer.Len())
+			loggers[name] = logger
+		}
+		loggers[name].level = level
+	}
+
+	for name, logger := range loggers {
+		if _, ok := config.LoggerLevels[name]; !ok {
+			logger.level = DEFAULT
+		}
+		logger.tagLevels = copyTagLevels(config.LoggerTagLevels[name])
+	}
+
+	if config.Formatter != nil {
+		defaultFormatter.Store(config.Formatter)
+	}
+
+	replaceAppenders(restored)
+	wait := defaultLogger.flushAfterLevelChange()
+	logMutex.Unlock()
+	wait.Wait()
+}
+
+func copyTagLevels(tagLevels map[string]LogLevel) map[string]LogLevel {
+	if tagLevels == nil {
+		return nil
+	}
+
+	copied := make(map[string]LogLevel, len(tagLevels))
+	for tag, level := range tagLevels {
+		copied[tag] = level
+	}
+	return copied
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSnapshotConfig(t *testing.T) {
+	logger, memory := setupImpl()
+	logger.SetLogLevel(WARN)
+	logger.SetTagLevel("one", DEBUG)
+	SetDefaultTagLogLevel("two", DEBUG)
+
+	config := SnapshotConfig()
+	defer ClearDefaultTagLogLevels()
+
+	SetDefaultLogLevel(ERROR)
+	logger.SetLogLevel(DEBUG)
+	logger.ClearTagLevels()
+	ClearDefaultTagLogLevels()
+	SetDefaultFormatter(GetFormatter(MINIMAL))
+	ReplaceAppenders([]LogAppender{NewNullAppender()})
+	added := GetLogger("snapshot-added").(*LoggerImpl)
+	added.SetLogLevel(DEBUG)
+
+	assert.Equal(t, config.LoggerTagLevels[logger.name], map[string]LogLevel{"one": DEBUG}, "the snapshot shouldn't change")
+
+	RestoreConfig(config)
+
+	assert.Equal(t, DefaultLevel(), INFO, "the default level should be restored")
+	assert.Equal(t, logger.Level(), WARN, "logger levels should be restored")
+	assert.True(t, logger.CheckLevel(DEBUG, []string{"one"}), "logger tag levels should be restored")
+	assert.True(t, CheckLevel(DEBUG, []string{"two"}), "default tag levels should be restored")
+	assert.Equal(t, added.Level(), INFO, "new loggers should go back to the default level")
+
+	logger.Warn("three")
+	WaitForIncoming()
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"three"}, "appenders should be restored")
+
+	config.DefaultTagLevels["two"] = ERROR
+	assert.True(t, CheckLevel(DEBUG, []string{"two"}), "the restored maps should be copies")
+}
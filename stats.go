@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"sync/atomic"
+)
+
+//The buckets in Stats.FlushOccupancy
+const (
+	//FlushEmpty counts flushes of buffers with no records
+	FlushEmpty = iota
+	//FlushUnderHalf counts flushes of buffers that were less than half full
+	FlushUnderHalf
+	//FlushOverHalf counts flushes of buffers that were at least half full, but not full
+	FlushOverHalf
+	//FlushFull counts flushes of full buffers, which may have lost records when they wrapped
+	FlushFull
+)
+
+/*
+Stats holds counters for the buffers, to help choose buffer lengths. The counters start when the
+program starts and only increase.
+
+A buffer that is often full when it is flushed is probably too short and losing records, which also
+shows up as suppressed records, one that is usually empty is probably wasting memory.
+*/
+type Stats struct {
+	//Replayed is the number of records replayed from logger and tag buffers
+	Replayed uint64
+	//FlushOccupancy counts logger and tag buffer flushes by how full the buffer was, indexed by FlushEmpty,
+	//FlushUnderHalf, FlushOverHalf and FlushFull
+	FlushOccupancy [4]uint64
+	//Suppressed is the number of records that left a logger buffer without being logged, because the
+	//buffer wrapped and overwrote them, or the buffer was resized or removed
+	Suppressed uint64
+}
+
+var replayedRecords uint64
+var suppressedRecords uint64
+var flushOccupancy [4]uint64
+
+//GetStats returns the current counters
+func GetStats() Stats {
+	var stats Stats
+
+	stats.Replayed = atomic.LoadUint64(&replayedRecords)
+	stats.Suppressed = atomic.LoadUint64(&suppressedRecords)
+
+	for i := range flushOccupancy {
+		stats.FlushOccupancy[i] = atomic.LoadUint64(&flushOccupancy[i])
+	}
+
+	return stats
+}
+
+//countFlush records a logger or tag buffer flush that replayed count records from a buffer of the length
+func countFlush(count int, length int) {
+	atomic.AddUint64(&replayedRecords, uint64(count))
+
+	bucket := FlushOverHalf
+
+	switch {
+	case count == 0:
+		bucket = FlushEmpty
+	case count >= length:
+		bucket = FlushFull
+	case count*2 < length:
+		bucket = FlushUnderHalf
+	}
+
+	atomic.AddUint64(&flushOccupancy[bucket], 1)
+}
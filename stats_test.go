@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReplayStats(t *testing.T) {
+	logger, _ := setup()
+	logger.SetBufferLength(4)
+	logger.SetLogLevel(ERROR)
+	WaitForIncoming()
+
+	before := GetStats()
+
+	logger.Info("one")
+	WaitForIncoming()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+	logger.SetLogLevel(ERROR)
+
+	for i := 0; i < 5; i++ {
+		logger.Info("many")
+	}
+	WaitForIncoming()
+	logger.SetLogLevel(INFO)
+	WaitForIncoming()
+
+	logger.SetLogLevel(ERROR)
+	WaitForIncoming()
+
+	after := GetStats()
+
+	assert.Equal(t, after.Replayed-before.Replayed, uint64(5), "the replayed records should be counted")
+	assert.Equal(t, after.FlushOccupancy[FlushUnderHalf]-before.FlushOccupancy[FlushUnderHalf], uint64(1), "one record in four is under half")
+	assert.Equal(t, after.FlushOccupancy[FlushFull]-before.FlushOccupancy[FlushFull], uint64(1), "a wrapped buffer is full")
+	assert.Equal(t, after.FlushOccupancy[FlushEmpty]-before.FlushOccupancy[FlushEmpty], uint64(2), "raising the level flushes the empty buffer")
+}
+
+func TestSuppressedStats(t *testing.T) {
+	logger, _ := setup()
+	logger.SetBufferLength(2)
+	logger.SetLogLevel(ERROR)
+	WaitForIncoming()
+
+	before := GetStats()
+
+	for i := 0; i < 5; i++ {
+		logger.Info("buffered")
+	}
+	WaitForIncoming()
+
+	assert.Equal(t, GetStats().Suppressed-before.Suppressed, uint64(3), "records overwritten by a wrap should be counted")
+
+	logger.SetBufferLength(3)
+	assert.Equal(t, GetStats().Suppressed-before.Suppressed, uint64(5), "records dropped with the old buffer should be counted")
+
+	logger.SetBufferLength(0)
+	assert.Equal(t, GetStats().Suppressed-before.Suppressed, uint64(5), "an empty buffer drops nothing")
+}
@@ -4,12 +4,23 @@ package logging
 
 import (
 	"log/syslog"
+	"time"
 )
 
+//DefaultSyslogRetryInterval is how long a SysLogAppender waits after failing to connect before it tries again
+const DefaultSyslogRetryInterval = 10 * time.Second
+
+//syslogDial connects to the syslog service, tests replace it to simulate failures
+var syslogDial = func() (*syslog.Writer, error) {
+	return syslog.New(syslog.LOG_DEBUG, "")
+}
+
 //SysLogAppender is the logging appender for appending to the syslog service
 type SysLogAppender struct {
 	BaseLogAppender
-	syslogger *syslog.Writer
+	syslogger     *syslog.Writer
+	retryInterval time.Duration
+	lastFailure   time.Time
 }
 
 /*
@@ -18,41 +29,84 @@ NewSysLogAppender creates a sys log appender
 func NewSysLogAppender() *SysLogAppender {
 	appender := new(SysLogAppender)
 	appender.level = DEFAULT
+	appender.retryInterval = DefaultSyslogRetryInterval
 	return appender
 }
 
+/*
+SetRetryInterval changes how long the appender waits after failing to connect before it tries again. Records
+logged while waiting are dropped without an error, so a missing syslog service produces one error per interval
+instead of one per record.
+*/
+func (appender *SysLogAppender) SetRetryInterval(interval time.Duration) {
+	appender.m.Lock()
+	appender.retryInterval = interval
+	appender.m.Unlock()
+}
+
+/*
+Verify connects to the syslog service, if the appender isn't connected already. Verify always tries to
+connect, even if a recent connection failed.
+*/
+func (appender *SysLogAppender) Verify() error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	return appender.connect()
+}
+
+//connect should be called inside the lock
+func (appender *SysLogAppender) connect() error {
+
+	if appender.syslogger == nil {
+		logWriter, e := syslogDial()
+
+		if e != nil {
+			appender.lastFailure = time.Now()
+			return e
+		}
+
+		appender.syslogger = logWriter
+	}
+
+	return nil
+}
+
+//waiting should be called inside the lock, it is true after a failed connection until the retry interval passes
+func (appender *SysLogAppender) waiting() bool {
+	return appender.syslogger == nil && !appender.lastFailure.IsZero() && time.Since(appender.lastFailure) < appender.retryInterval
+}
+
 /*
 Log adds a record to the sys log
 */
 func (appender *SysLogAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
 
-	if !appender.CheckLevel(record.Level) {
+	if !appender.checkLevel(record.Level) {
 		return nil
 	}
 
-	if appender.syslogger == nil {
-		logWriter, e := syslog.New(syslog.LOG_DEBUG, "")
+	if appender.waiting() {
+		return nil
+	}
 
-		if e == nil {
-			appender.syslogger = logWriter
-		} else {
-			return e
-		}
+	if e := appender.connect(); e != nil {
+		return e
 	}
 
 	if appender.syslogger != nil {
 
 		formatted := appender.format(record)
 
-		switch record.Level {
-		case DEBUG:
-			return appender.syslogger.Debug(formatted)
-		case INFO:
-			return appender.syslogger.Info(formatted)
-		case WARN:
-			return appender.syslogger.Warning(formatted)
-		case ERROR:
+		switch {
+		case record.Level >= ERROR:
 			return appender.syslogger.Err(formatted)
+		case record.Level == WARN:
+			return appender.syslogger.Warning(formatted)
+		case record.Level == INFO:
+			return appender.syslogger.Info(formatted)
 		default:
 			return appender.syslogger.Debug(formatted)
 		}
@@ -0,0 +1,41 @@
+// +build !windows
+
+package logging
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"log/syslog"
+	"testing"
+	"time"
+)
+
+func TestSysLogAppenderBackoff(t *testing.T) {
+	dial := syslogDial
+	defer func() { syslogDial = dial }()
+
+	attempts := 0
+	syslogDial = func() (*syslog.Writer, error) {
+		attempts++
+		return nil, fmt.Errorf("syslog is down")
+	}
+
+	app := NewSysLogAppender()
+	record := NewLogRecord(nil, INFO, nil, "one", time.Now(), time.Now())
+
+	assert.NotNil(t, app.Log(record), "the first failure should be returned")
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, app.Log(record), "records are dropped while waiting to retry")
+	}
+
+	assert.Equal(t, attempts, 1, "the appender shouldn't retry before the interval")
+
+	app.SetRetryInterval(0)
+	assert.NotNil(t, app.Log(record), "the appender should retry after the interval")
+	assert.Equal(t, attempts, 2, "the appender should retry after the interval")
+
+	app.SetRetryInterval(time.Hour)
+	assert.NotNil(t, app.Verify(), "verify should always try to connect")
+	assert.Equal(t, attempts, 3, "verify should always try to connect")
+}
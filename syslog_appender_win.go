@@ -4,6 +4,7 @@ package logging
 
 import (
 	"errors"
+	"time"
 )
 
 type SysLogAppender struct {
@@ -24,6 +25,13 @@ func (appender *SysLogAppender) Log(record *LogRecord) error {
 	return errors.New("Syslog is not supported on Windows")
 }
 
+func (appender *SysLogAppender) SetRetryInterval(interval time.Duration) {
+}
+
+func (appender *SysLogAppender) Verify() error {
+	return errors.New("Syslog is not supported on Windows")
+}
+
 func (appender *SysLogAppender) Close() error {
 	return nil
 }
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"sync/atomic"
+)
+
+//TestingTB is the part of testing.TB that test mode and the TestingAppender use, so that the package
+//doesn't link the testing package into every program, a *testing.T or *testing.B can be passed
+type TestingTB interface {
+	Errorf(format string, args ...interface{})
+	Log(args ...interface{})
+	Cleanup(func())
+}
+
+//testReporter holds the test that logging errors are reported to in test mode
+type testReporter struct {
+	tb TestingTB
+}
+
+var testMode atomic.Value
+
+/*
+EnableTestMode makes logging easier to use in tests. Logging becomes synchronous, like SetSynchronous(true),
+so records are appended before the logging call returns and WaitForIncoming isn't needed, and every logging
+error, including those returned by appenders, fails the test with t.Error. The error channels still get the
+errors too.
+
+When the test finishes, queued records are waited for, and synchronous logging and the error reporting are
+turned off. Only one test at a time can use test mode, enabling it again replaces the earlier test.
+*/
+func EnableTestMode(t TestingTB) {
+	reporter := &testReporter{tb: t}
+	testMode.Store(reporter)
+	SetSynchronous(true)
+
+	t.Cleanup(func() {
+		WaitForIncoming()
+
+		if current, _ := testMode.Load().(*testReporter); current == reporter {
+			SetSynchronous(false)
+			testMode.Store((*testReporter)(nil))
+		}
+	})
+}
+
+//testModeTB returns the test in test mode, or nil
+func testModeTB() TestingTB {
+	reporter, _ := testMode.Load().(*testReporter)
+
+	if reporter == nil {
+		return nil
+	}
+
+	return reporter.tb
+}
+
+//TestingAppender writes records to a test's log with t.Log, so they are shown with the test that logged
+//them, and only when it fails or go test is run with -v. Records appended after the test finishes are
+//dropped, because the testing package doesn't allow logging then. It works best with EnableTestMode, so
+//records are written before the test moves on:
+//
+//	EnableTestMode(t)
+//	AddAppender(NewTestingAppender(t))
+type TestingAppender struct {
+	BaseLogAppender
+	tb       TestingTB
+	finished bool
+}
+
+//NewTestingAppender creates an appender for the test
+func NewTestingAppender(t TestingTB) *TestingAppender {
+	appender := &TestingAppender{tb: t}
+
+	t.Cleanup(func() {
+		appender.m.Lock()
+		appender.finished = true
+		appender.m.Unlock()
+	})
+
+	return appender
+}
+
+//Log formats the record and passes it to t.Log
+func (appender *TestingAppender) Log(record *LogRecord) error {
+	appender.m.Lock()
+	defer appender.m.Unlock()
+
+	if appender.finished || !appender.checkLevel(record.Level) {
+		return nil
+	}
+
+	appender.tb.Log(appender.format(record))
+	return nil
+}
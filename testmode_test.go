@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+)
+
+//fakeTB records the errors, logs and cleanups from test mode, so they can be checked without failing the real test
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	logs     []string
+	cleanups []func()
+}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) Cleanup(f func()) {
+	tb.cleanups = append(tb.cleanups, f)
+}
+
+func (tb *fakeTB) Log(args ...interface{}) {
+	tb.logs = append(tb.logs, fmt.Sprint(args...))
+}
+
+func (tb *fakeTB) cleanup() {
+	for _, cleanup := range tb.cleanups {
+		cleanup()
+	}
+}
+
+func TestEnableTestMode(t *testing.T) {
+	logger, memory := setup()
+	tb := &fakeTB{TB: t}
+	EnableTestMode(tb)
+
+	logger.Info("synchronous")
+	assert.Equal(t, memory.GetLoggedMessages(), []string{"synchronous"}, "records should be appended before the call returns")
+
+	AddAppender(NewErrorAppender())
+	logger.Info("fails")
+	assert.Equal(t, len(tb.errors), 1, "appender errors should be reported to the test")
+	assert.Contains(t, tb.errors[0], "error: fails", "the appender's error should be reported")
+
+	tb.cleanup()
+
+	assert.Equal(t, atomic.LoadInt32(&synchronous), int32(0), "cleanup should turn off synchronous logging")
+	logger.Info("fails again")
+	WaitForIncoming()
+	assert.Equal(t, len(tb.errors), 1, "errors aren't reported after cleanup")
+}
+
+func TestTestingAppender(t *testing.T) {
+	logger, _ := setup()
+	tb := &fakeTB{TB: t}
+	EnableTestMode(tb)
+
+	app := NewTestingAppender(tb)
+	app.SetFormatter(GetFormatter(MINIMAL))
+	AddAppender(app)
+
+	logger.Info("to the test")
+	assert.Equal(t, tb.logs, []string{"to the test"}, "records should be passed to t.Log")
+
+	tb.cleanup()
+	logger.Info("after the test")
+	WaitForIncoming()
+	assert.Equal(t, len(tb.logs), 1, "records after the test finishes are dropped")
+}